@@ -0,0 +1,222 @@
+package simplelog
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/tanzy2018/simplelog/encode"
+)
+
+type overflowMode int
+
+const (
+	overflowBlock overflowMode = iota
+	overflowDropNewest
+	overflowDropOldest
+	overflowDropBelow
+)
+
+// OverflowPolicy ... what WithAsync does with a record when its queue is full.
+type OverflowPolicy struct {
+	mode  overflowMode
+	level LevelType
+}
+
+var (
+	// OverflowBlock ... the caller waits for room in the queue, nothing is dropped.
+	OverflowBlock = OverflowPolicy{mode: overflowBlock}
+	// OverflowDropNewest ... the record at hand is dropped.
+	OverflowDropNewest = OverflowPolicy{mode: overflowDropNewest}
+	// OverflowDropOldest ... the oldest record of the queue is dropped to make room.
+	OverflowDropOldest = OverflowPolicy{mode: overflowDropOldest}
+)
+
+// OverflowDropBelow ... the record is dropped if its level is below level,
+// otherwise the caller waits for room in the queue.
+func OverflowDropBelow(level LevelType) OverflowPolicy {
+	return OverflowPolicy{mode: overflowDropBelow, level: level}
+}
+
+// asyncRecord ... a record encoded by each of the distinct encoders
+// enabled for its level, nil for the others.
+type asyncRecord struct {
+	level LevelType
+	recs  [][]byte
+}
+
+type asyncQueue struct {
+	// dropped and reported are accessed atomically, the first for the alignment on 32-bit.
+	dropped  uint64
+	reported uint64
+
+	q      chan asyncRecord
+	policy OverflowPolicy
+	// flushc asks the writer goroutine to write the queued records and flush the sinks.
+	flushc chan chan error
+	// done is closed once the writer goroutine has drained the queue after Close.
+	done chan struct{}
+}
+
+func newAsyncQueue(capacity int, policy OverflowPolicy) *asyncQueue {
+	return &asyncQueue{
+		q:      make(chan asyncRecord, capacity),
+		policy: policy,
+		flushc: make(chan chan error),
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue hands r over to the writer goroutine per the policy, giving up once stop is closed.
+func (aq *asyncQueue) enqueue(r asyncRecord, stop chan struct{}) {
+	select {
+	case aq.q <- r:
+		return
+	default:
+	}
+	switch aq.policy.mode {
+	case overflowDropNewest:
+		aq.drop()
+		return
+	case overflowDropBelow:
+		if r.level < aq.policy.level {
+			aq.drop()
+			return
+		}
+	case overflowDropOldest:
+		for {
+			select {
+			case aq.q <- r:
+				return
+			default:
+			}
+			select {
+			case <-aq.q:
+				aq.drop()
+			default:
+			}
+		}
+	}
+	select {
+	case aq.q <- r:
+	case <-stop:
+	}
+}
+
+func (aq *asyncQueue) drop() {
+	atomic.AddUint64(&aq.dropped, 1)
+}
+
+// Dropped ... the number of records dropped by the overflow policy of WithAsync so far.
+func (l *Log) Dropped() uint64 {
+	if l.async == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&l.async.dropped)
+}
+
+// encodeAsync encodes e and md with rb once per distinct encoder enabled for its level, into its own bytes.
+func (l *Log) encodeAsync(rb *recordBuffer, e *entry, md []encode.Meta) asyncRecord {
+	r := asyncRecord{level: e.level, recs: make([][]byte, len(l.encoders))}
+	l.encodeEntry(rb, e, md, func(i int, b []byte) {
+		r.recs[i] = append(make([]byte, 0, len(b)), b...)
+	})
+	return r
+}
+
+// writeAsync copies r into the buffers of the sinks enabled for its level,
+// flushing those being full.
+func (l *Log) writeAsync(r asyncRecord) {
+	for _, s := range l.sinks {
+		if !s.enabled(r.level) || r.recs[s.encIdx] == nil {
+			continue
+		}
+		s.syncBuf.write(r.recs[s.encIdx])
+		if s.syncBuf.full() {
+			if err := s.flush(); err != ErrClosed {
+				l.errHandle(err)
+			}
+		}
+	}
+}
+
+// flushAsync flushes the sinks, only those of WithSyncDirect unless all.
+func (l *Log) flushAsync(all bool) error {
+	var err error
+	for _, s := range l.sinks {
+		if !all && !s.op.syncDirect {
+			continue
+		}
+		if serr := s.flush(); err == nil && serr != ErrClosed {
+			err = serr
+		}
+	}
+	return err
+}
+
+// drainAsync writes the records queued so far.
+func (l *Log) drainAsync() {
+	for {
+		select {
+		case r := <-l.async.q:
+			l.writeAsync(r)
+		default:
+			return
+		}
+	}
+}
+
+// reportDropped logs the number of records dropped since the last report, if any.
+func (l *Log) reportDropped() {
+	dropped := atomic.LoadUint64(&l.async.dropped)
+	n := dropped - atomic.LoadUint64(&l.async.reported)
+	if n == 0 {
+		return
+	}
+	atomic.StoreUint64(&l.async.reported, dropped)
+	e := entry{level: WARN, msg: "dropped"}
+	rb := getRecordBuffer()
+	if l.op.enableTimeField {
+		e.time = l.op.timeMeta(rb)
+	}
+	r := l.encodeAsync(rb, &e, []encode.Meta{encode.Uint64("dropped", n)})
+	putRecordBuffer(rb)
+	l.writeAsync(r)
+}
+
+// backendAsync starts the writer goroutine, which batches the queued records
+// and flushes the sinks of WithSyncDirect once the queue is empty.
+func (l *Log) backendAsync() {
+	if l.async == nil {
+		return
+	}
+	go func() {
+		defer close(l.async.done)
+		var tick <-chan time.Time
+		if l.op.droppedInterval > 0 {
+			ticker := time.NewTicker(l.op.droppedInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case r := <-l.async.q:
+				l.writeAsync(r)
+				if len(l.async.q) == 0 {
+					l.errHandle(l.flushAsync(false))
+				}
+			case done := <-l.async.flushc:
+				l.drainAsync()
+				done <- l.flushAsync(true)
+			case <-tick:
+				l.reportDropped()
+				l.errHandle(l.flushAsync(false))
+			case <-l.stop:
+				l.drainAsync()
+				if tick != nil {
+					l.reportDropped()
+				}
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,110 @@
+package simplelog
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testGateWriter blocks the writes until gate is closed, telling entered of the first one.
+type testGateWriter struct {
+	testWriter
+	gate    chan struct{}
+	entered chan struct{}
+}
+
+func (w *testGateWriter) Write(b []byte) (int, error) {
+	select {
+	case w.entered <- struct{}{}:
+	default:
+	}
+	<-w.gate
+	return w.testWriter.Write(b)
+}
+
+func TestAsync(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithAsync(16, OverflowBlock)).WithWriterCloser(w, false, true)
+	defer l.Close()
+	for i := 0; i < 100; i++ {
+		l.Info(strconv.Itoa(i))
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	records := w.records(t)
+	if len(records) != 100 {
+		t.Fatalf("expected 100 records, actual %d", len(records))
+	}
+	for i, record := range records {
+		if record["msg"] != strconv.Itoa(i) {
+			t.Fatalf("expected the records in order, actual %v at %d", record["msg"], i)
+		}
+	}
+	if l.Dropped() != 0 {
+		t.Errorf("expected no dropped records, actual %d", l.Dropped())
+	}
+}
+
+func TestAsyncDropped(t *testing.T) {
+	w := &testGateWriter{gate: make(chan struct{}), entered: make(chan struct{}, 1)}
+	l := New(WithAsync(2, OverflowDropNewest), WithDroppedInterval(time.Hour)).WithWriterCloser(w, false, true)
+	// the writer goroutine blocks on the gate with the first record,
+	// so the queue holds the next two and the others are dropped.
+	l.Info("0")
+	<-w.entered
+	for i := 1; i < 10; i++ {
+		l.Info(strconv.Itoa(i))
+	}
+	dropped := l.Dropped()
+	if dropped != 7 {
+		t.Errorf("expected 7 dropped records, actual %d", dropped)
+	}
+	close(w.gate)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	records := w.records(t)
+	if len(records) != 10-int(dropped)+1 {
+		t.Fatalf("unexpected records: %v", records)
+	}
+	summary := records[len(records)-1]
+	if summary["msg"] != "dropped" || summary["level"] != "warn" || summary["dropped"] != float64(dropped) {
+		t.Errorf("unexpected summary: %v", summary)
+	}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	levels := func(aq *asyncQueue) []LevelType {
+		var levels []LevelType
+		for len(aq.q) > 0 {
+			levels = append(levels, (<-aq.q).level)
+		}
+		return levels
+	}
+	stop := make(chan struct{})
+	close(stop)
+	tests := []struct {
+		policy  OverflowPolicy
+		levels  []LevelType
+		dropped uint64
+	}{
+		{OverflowBlock, []LevelType{DEBUG, INFO}, 0},
+		{OverflowDropNewest, []LevelType{DEBUG, INFO}, 2},
+		{OverflowDropOldest, []LevelType{WARN, ERROR}, 2},
+		{OverflowDropBelow(ERROR), []LevelType{DEBUG, INFO}, 1},
+	}
+	for _, test := range tests {
+		aq := newAsyncQueue(2, test.policy)
+		for _, level := range []LevelType{DEBUG, INFO, WARN, ERROR} {
+			// with stop closed, the blocking policies give up instead of waiting.
+			aq.enqueue(asyncRecord{level: level}, stop)
+		}
+		if levels := levels(aq); len(levels) != 2 || levels[0] != test.levels[0] || levels[1] != test.levels[1] {
+			t.Errorf("%v: expected %v, actual %v", test.policy, test.levels, levels)
+		}
+		if aq.dropped != test.dropped {
+			t.Errorf("%v: expected %d dropped, actual %d", test.policy, test.dropped, aq.dropped)
+		}
+	}
+}
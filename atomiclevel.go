@@ -0,0 +1,150 @@
+package simplelog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AtomicLevel ... a level which is safe to change while the Log is in use.
+// It is also an http.Handler:
+// GET reports the current level as {"level":"info"},
+// PUT changes it with a body like {"level":"debug","duration":"10m"},
+// where the optional duration reverts the level after it elapses.
+type AtomicLevel struct {
+	level int32
+	lo    sync.Mutex
+	// revert is the pending timer of SetLevelFor, gen guards against stale ones.
+	revert   *time.Timer
+	revertTo int32
+	gen      uint64
+}
+
+// NewAtomicLevel ...
+func NewAtomicLevel(level LevelType) *AtomicLevel {
+	al := &AtomicLevel{}
+	if !level.isValid() {
+		level = DEBUG
+	}
+	al.level = int32(level)
+	return al
+}
+
+// Level ...
+func (al *AtomicLevel) Level() LevelType {
+	return LevelType(atomic.LoadInt32(&al.level))
+}
+
+// Enabled ... reports whether a record of level would be written.
+func (al *AtomicLevel) Enabled(level LevelType) bool {
+	return level >= al.Level()
+}
+
+// SetLevel ... an invalid level is ignored. It cancels a pending revert of SetLevelFor.
+func (al *AtomicLevel) SetLevel(level LevelType) {
+	if !level.isValid() {
+		return
+	}
+	al.lo.Lock()
+	defer al.lo.Unlock()
+	al.stopRevert()
+	atomic.StoreInt32(&al.level, int32(level))
+}
+
+// SetLevelFor ... sets the level and falls back to the current one after dur,
+// e.g. to elevate to DEBUG for a while. A non-positive dur behaves like SetLevel.
+func (al *AtomicLevel) SetLevelFor(level LevelType, dur time.Duration) {
+	if dur <= 0 {
+		al.SetLevel(level)
+		return
+	}
+	if !level.isValid() {
+		return
+	}
+	al.lo.Lock()
+	defer al.lo.Unlock()
+	// a pending revert keeps reverting to the level from before the first elevation.
+	prev := atomic.LoadInt32(&al.level)
+	if al.revert != nil {
+		prev = al.revertTo
+	}
+	al.stopRevert()
+	atomic.StoreInt32(&al.level, int32(level))
+	al.revertTo = prev
+	gen := al.gen
+	al.revert = time.AfterFunc(dur, func() {
+		al.lo.Lock()
+		defer al.lo.Unlock()
+		if al.gen != gen {
+			return
+		}
+		al.revert = nil
+		atomic.StoreInt32(&al.level, prev)
+	})
+}
+
+func (al *AtomicLevel) stopRevert() {
+	al.gen++
+	if al.revert != nil {
+		al.revert.Stop()
+		al.revert = nil
+	}
+}
+
+type levelPayload struct {
+	Level    string `json:"level"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type errorPayload struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP ...
+func (al *AtomicLevel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req levelPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorPayload{Error: "invalid body: " + err.Error()})
+			return
+		}
+		if len(req.Level) == 0 {
+			writeJSON(w, http.StatusBadRequest, errorPayload{Error: "level is required"})
+			return
+		}
+		level, err := ParseLevel(req.Level)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorPayload{Error: err.Error()})
+			return
+		}
+		var dur time.Duration
+		if len(req.Duration) > 0 {
+			if dur, err = time.ParseDuration(req.Duration); err != nil {
+				writeJSON(w, http.StatusBadRequest, errorPayload{Error: "invalid duration: " + err.Error()})
+				return
+			}
+		}
+		al.SetLevelFor(level, dur)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorPayload{Error: "only GET and PUT are supported"})
+		return
+	}
+	// the name of NOLEVEL is empty, MarshalText gives "off" which PUT accepts back.
+	text, err := al.Level().MarshalText()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorPayload{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, levelPayload{Level: string(text)})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
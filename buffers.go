@@ -3,23 +3,26 @@ package simplelog
 import (
 	"bytes"
 	"sync"
+	"time"
 
 	"github.com/tanzy2018/simplelog/encode"
 	"github.com/tanzy2018/simplelog/internal"
 )
 
 type syncBuffer struct {
-	buf     *bytes.Buffer
+	buf *bytes.Buffer
+	// spare holds the bytes returned by the last flushAsBytes, reused by the next one,
+	// so that the records appended meanwhile never overwrite the bytes being written.
+	spare   *bytes.Buffer
 	maxSize int
-	l       *Log
 	lo      *sync.Mutex
 }
 
-func newSyncBuffers(l *Log, maxSize int) *syncBuffer {
+func newSyncBuffers(maxSize int) *syncBuffer {
 	sb := &syncBuffer{
 		maxSize: maxSize,
 		buf:     &bytes.Buffer{},
-		l:       l,
+		spare:   &bytes.Buffer{},
 		lo:      new(sync.Mutex),
 	}
 	return sb
@@ -33,149 +36,134 @@ func (sb *syncBuffer) unlock() {
 	sb.lo.Unlock()
 }
 
-func (sb *syncBuffer) write(b []byte) (sync bool) {
+func (sb *syncBuffer) write(b []byte) {
 	sb.lock()
 	defer sb.unlock()
 	sb.buf.Grow(len(b))
 	sb.buf.WriteString(internal.ToString(b))
+}
+
+func (sb *syncBuffer) full() bool {
+	sb.lock()
+	defer sb.unlock()
 	return sb.buf.Len() >= sb.maxSize
 }
 
+// flushAsBytes returns the buffered bytes, valid until the next call,
+// the callers being serialized by the lock of the Sink.
 func (sb *syncBuffer) flushAsBytes() []byte {
 	sb.lock()
 	defer sb.unlock()
 	b := sb.buf.Bytes()
+	sb.buf, sb.spare = sb.spare, sb.buf
 	sb.buf.Reset()
 	return b
 }
 
-type recordBuffer struct {
-	buf     *bytes.Buffer
-	maxSize int
-	l       *Log
-	lo      *sync.Mutex
+// entry ... a record before it is encoded.
+type entry struct {
+	level  LevelType
+	msg    string
+	caller *callerFrame
+	// fields are the fields bound by With, encoded ahead of time by the encoder at hand.
+	fields []byte
+	stack  encode.Meta
+	// time and hooks are evaluated once, for all the encoders.
+	time  encode.Meta
+	hooks []encode.Meta
 }
 
-func newRecordBuffers(l *Log, maxSize int) *recordBuffer {
-	rb := &recordBuffer{
-		maxSize: maxSize,
-		buf:     &bytes.Buffer{},
-		l:       l,
-		lo:      new(sync.Mutex),
-	}
-	return rb
+// recordBuffer ... the buffer encoding a single record, taken from recordBufferPool
+// for each call, so that the callers encode in parallel.
+type recordBuffer struct {
+	buf []byte
+	// hooks holds the Meta of the hooks of the record, time its time field if not cached.
+	hooks []encode.Meta
+	time  []byte
 }
 
-func (rb *recordBuffer) lock() {
-	rb.lo.Lock()
+// maxPooledRecordSize ... the larger buffers are left to the GC instead of being pooled.
+const maxPooledRecordSize = 64 * 1024
+
+var recordBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &recordBuffer{buf: make([]byte, 0, 1024)}
+	},
 }
 
-func (rb *recordBuffer) unlock() {
-	rb.buf.Reset()
-	rb.lo.Unlock()
+func getRecordBuffer() *recordBuffer {
+	return recordBufferPool.Get().(*recordBuffer)
 }
 
-func (rb *recordBuffer) write(level LevelType, msg string, md []encode.Meta) []byte {
-	rb.lock()
-	defer rb.unlock()
-	rb.buf.Reset()
-	//rb.buf.Grow(rb.maxSize)
-	md0 := make([]encode.Meta, 0, 3)
-	if EnableTimeField {
-		md0 = append(md0, timeMeta())
+func putRecordBuffer(rb *recordBuffer) {
+	if cap(rb.buf) > maxPooledRecordSize {
+		return
 	}
-	md0 = append(md0,
-		levelMeta(level),
-		msgMeta(msg))
-	md0 = append(md0, rb.l.op.hook.Hooks()...)
-
-	rb.writeLeftDelimiter()
-	rb.writeCommonMeta(md0)
-	rb.writeCustomMeta(md)
-	if level == PANIC {
-		rb.writeStackMeta()
+	rb.buf = rb.buf[:0]
+	for i := range rb.hooks {
+		rb.hooks[i] = encode.Meta{}
 	}
-	rb.writeRightDelimiter()
-	rb.writeEndDelimiter()
-	return rb.buf.Bytes()
-
+	rb.hooks = rb.hooks[:0]
+	recordBufferPool.Put(rb)
 }
 
-func (rb *recordBuffer) writeCommonMeta(md []encode.Meta) {
-	for i, msg := range md {
-		if i != 0 {
-			rb.writeFieldDelimiter()
-		}
-		rb.writeWrapper()
-		rb.buf.Write(msg.Key())
-		rb.writeWrapper()
-		rb.writeKVDelimiter()
-		if msg.Wrap() {
-			rb.writeWrapper()
-		}
-		rb.buf.Write(msg.Value())
-		if msg.Wrap() {
-			rb.writeWrapper()
-		}
+// formatTime returns the time field formatted into rb, sparing the allocation of encode.TimeLayout.
+func (rb *recordBuffer) formatTime(key string, t time.Time, layout string) encode.Meta {
+	switch layout {
+	case encode.UnixLayout, encode.UnixMilliLayout, encode.UnixMicroLayout, encode.UnixNanoLayout:
+		return encode.TimeLayout(key, t, layout)
 	}
+	rb.time = t.AppendFormat(rb.time[:0], layout)
+	return encode.Bytes(key, rb.time)
 }
 
-func (rb *recordBuffer) writeCustomMeta(md []encode.Meta) {
-	for _, msg := range md {
-		size := rb.buf.Len() + len(msg.Key()) + len(msg.Value())
-		if size >= rb.maxSize {
-			return
-		}
-		rb.writeFieldDelimiter()
-		rb.writeWrapper()
-		rb.buf.Write(msg.Key())
-		rb.writeWrapper()
-		rb.writeKVDelimiter()
-		if msg.Wrap() {
-			rb.writeWrapper()
-		}
-		rb.buf.Write(msg.Value())
-		if msg.Wrap() {
-			rb.writeWrapper()
-		}
+// evalHooks returns the Meta of the hooks of h, in rb unless h is a custom IHook.
+func (rb *recordBuffer) evalHooks(h IHook) []encode.Meta {
+	if hk, ok := h.(*hook); ok {
+		rb.hooks = hk.appendHooks(rb.hooks[:0])
+		return rb.hooks
 	}
+	return h.Hooks()
 }
 
-func (rb *recordBuffer) writeStackMeta() {
-	md := stackMeta()
-	rb.writeWrapper()
-	rb.buf.Write(md.Key())
-	rb.writeWrapper()
-	rb.writeKVDelimiter()
-	if md.Wrap() {
-		rb.writeWrapper()
+// write encodes e and md with enc, overwriting the record encoded before.
+// It may encode several records per the RecordSizePolicy.
+func (rb *recordBuffer) write(op *options, enc Encoder, e *entry, md []encode.Meta) []byte {
+	rw := recordWriter{op: op, enc: enc, e: *e, buf: rb.buf[:0]}
+	rw.begin()
+	for _, msg := range e.hooks {
+		rw.add(msg)
 	}
-	rb.buf.Write(md.Value())
-	if md.Wrap() {
-		rb.writeWrapper()
+	for _, msg := range md {
+		rw.add(msg)
 	}
+	if !e.stack.IsZero() {
+		rw.addStack(e.stack)
+	}
+	rw.end()
+	rb.buf = rw.buf
+	return rb.buf
 }
 
-func (rb *recordBuffer) writeWrapper() {
-	rb.buf.WriteByte(valueWrapper)
-}
-
-func (rb *recordBuffer) writeLeftDelimiter() {
-	rb.buf.WriteByte(leftDelimiter)
-}
-
-func (rb *recordBuffer) writeRightDelimiter() {
-	rb.buf.WriteByte(rightDelimiter)
-}
-
-func (rb *recordBuffer) writeEndDelimiter() {
-	rb.buf.WriteByte(endDelimiter)
-}
-
-func (rb *recordBuffer) writeFieldDelimiter() {
-	rb.buf.WriteByte(fieldDelimiter)
+// encodeFields encodes md with enc as a fragment of fields,
+// ready to be spliced into a record by Encoder.AppendEncoded.
+func (op *options) encodeFields(enc Encoder, md []encode.Meta) []byte {
+	var fields []byte
+	for _, msg := range md {
+		fields = op.appendMeta(enc, fields, msg)
+	}
+	return fields
 }
 
-func (rb *recordBuffer) writeKVDelimiter() {
-	rb.buf.WriteByte(kvDelimiter)
+// appendMeta appends md with enc, expanding the Metas of a group such as encode.NamedErr
+// and encoding the NaN and infinite floats per the float policy.
+func (op *options) appendMeta(enc Encoder, dst []byte, md encode.Meta) []byte {
+	md = encode.ApplyFloatPolicy(md, op.floatPolicy)
+	if g := md.Metas(); g != nil {
+		for _, msg := range g {
+			dst = op.appendMeta(enc, dst, msg)
+		}
+		return dst
+	}
+	return enc.AppendMeta(dst, md)
 }
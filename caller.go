@@ -0,0 +1,64 @@
+package simplelog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// callerCache maps a pc to its *callerFrame, the call sites of a program being finite.
+var callerCache sync.Map
+
+type callerFrame struct {
+	// caller is the short file:line, e.g. pkg/handler.go:42.
+	caller string
+	// function is the short function name, e.g. pkg.(*Handler).ServeHTTP.
+	function string
+}
+
+// callerPC returns the pc of the caller skip frames above the function calling callerPC.
+func callerPC(skip int) uintptr {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) < 1 {
+		return 0
+	}
+	return pcs[0]
+}
+
+func lookupCaller(pc uintptr) *callerFrame {
+	if cf, ok := callerCache.Load(pc); ok {
+		return cf.(*callerFrame)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	cf := newCallerFrame(&frame)
+	callerCache.Store(pc, cf)
+	return cf
+}
+
+func newCallerFrame(frame *runtime.Frame) *callerFrame {
+	return &callerFrame{
+		caller:   shortFile(frame.File) + ":" + strconv.Itoa(frame.Line),
+		function: shortFunction(frame.Function),
+	}
+}
+
+// shortFile keeps the last directory and the file name of a path.
+func shortFile(file string) string {
+	idx := strings.LastIndexByte(file, '/')
+	if idx < 0 {
+		return file
+	}
+	if idx = strings.LastIndexByte(file[:idx], '/'); idx < 0 {
+		return file
+	}
+	return file[idx+1:]
+}
+
+// shortFunction trims the import path of the package from a function name.
+func shortFunction(function string) string {
+	if idx := strings.LastIndexByte(function, '/'); idx >= 0 {
+		return function[idx+1:]
+	}
+	return function
+}
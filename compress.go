@@ -0,0 +1,86 @@
+package simplelog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+)
+
+// CompressFormat ... the format of WithCompressRotated.
+type CompressFormat int
+
+const (
+	// CompressNone ... keep the rotated files as they are, the default.
+	CompressNone CompressFormat = iota
+	// CompressGzip ... compress the rotated files to *.gz.
+	CompressGzip
+)
+
+// zstd is left out on purpose, simplelog depends on the standard library only.
+
+// ext ... the extension added to the compressed files.
+func (f CompressFormat) ext() string {
+	if f == CompressGzip {
+		return ".gz"
+	}
+	return ""
+}
+
+// compressFile compresses name to name+ext atomically through a temp file,
+// keeping its mod time for the retention, and removes name on success.
+func compressFile(name string, f CompressFormat) (err error) {
+	if f != CompressGzip {
+		return nil
+	}
+	src, err := os.Open(name)
+	if os.IsNotExist(err) {
+		// removed by the retention of a later rotation in the meantime.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst := name + f.ext()
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+		}
+	}()
+	zw, err := gzip.NewWriterLevel(out, gzip.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	zw.Name, zw.ModTime = path.Base(name), fi.ModTime()
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp, fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,164 @@
+package simplelog
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tanzy2018/simplelog/encode"
+)
+
+// ANSI colors of the levels.
+var levelColors = [...]string{
+	DEBUG: "\x1b[35m",
+	INFO:  "\x1b[34m",
+	WARN:  "\x1b[33m",
+	ERROR: "\x1b[31m",
+	PANIC: "\x1b[1;31m",
+	FATAL: "\x1b[1;31m",
+}
+
+const colorReset = "\x1b[0m"
+
+// ConsoleEncoder ... a human-readable Encoder for local development, e.g.
+//
+//	2020-08-11 10:28:18 INFO  profile name=Tom id=10
+//
+// Keys are omitted for the time, level and msg fields,
+// string values are quoted only if they contain spaces, '=', quotes or control characters,
+// the msg only if it contains control characters,
+// and the stack goes to the following line.
+type ConsoleEncoder struct {
+	// Color ... color the level with ANSI escape codes.
+	Color bool
+}
+
+// NewConsoleEncoder ... Color is enabled if w is a terminal and the NO_COLOR environment variable is not set.
+func NewConsoleEncoder(w io.Writer) *ConsoleEncoder {
+	return &ConsoleEncoder{
+		Color: isTerminal(w) && len(os.Getenv("NO_COLOR")) == 0,
+	}
+}
+
+// Begin ...
+func (enc *ConsoleEncoder) Begin(dst []byte) []byte {
+	return dst
+}
+
+// AppendTime ...
+func (enc *ConsoleEncoder) AppendTime(dst []byte, md encode.Meta) []byte {
+	dst = enc.appendSpace(dst)
+	return append(dst, md.Value()...)
+}
+
+// AppendLevel ...
+func (enc *ConsoleEncoder) AppendLevel(dst []byte, key string, level LevelType) []byte {
+	dst = enc.appendSpace(dst)
+	color := enc.Color && level.isValid() && int(level) < len(levelColors) && len(levelColors[level]) > 0
+	if color {
+		dst = append(dst, levelColors[level]...)
+	}
+	name := strings.ToUpper(level.String())
+	dst = append(dst, name...)
+	if color {
+		dst = append(dst, colorReset...)
+	}
+	// align the messages on the longest level name.
+	for i := len(name); i < 5; i++ {
+		dst = append(dst, ' ')
+	}
+	return dst
+}
+
+// AppendMsg ... quoted and escaped if msg contains control characters, e.g. a newline which would forge a line.
+func (enc *ConsoleEncoder) AppendMsg(dst []byte, key, msg string) []byte {
+	dst = enc.appendSpace(dst)
+	if !hasControl(msg) {
+		return append(dst, msg...)
+	}
+	dst = append(dst, valueWrapper)
+	dst = encode.AppendString(dst, msg, false)
+	return append(dst, valueWrapper)
+}
+
+// AppendMeta ...
+func (enc *ConsoleEncoder) AppendMeta(dst []byte, md encode.Meta) []byte {
+	dst = enc.appendSpace(dst)
+	dst = appendKeyValue(dst, md.Key())
+	dst = append(dst, '=')
+	if md.Wrap() {
+		return appendKeyValue(dst, md.Value())
+	}
+	return md.AppendValue(dst)
+}
+
+// AppendEncoded ...
+func (enc *ConsoleEncoder) AppendEncoded(dst, fields []byte) []byte {
+	if len(fields) == 0 {
+		return dst
+	}
+	return append(enc.appendSpace(dst), fields...)
+}
+
+// AppendStack ...
+func (enc *ConsoleEncoder) AppendStack(dst []byte, md encode.Meta) []byte {
+	dst = append(dst, '\n', '\t')
+	return append(dst, md.Value()...)
+}
+
+// End ...
+func (enc *ConsoleEncoder) End(dst []byte) []byte {
+	return append(dst, endDelimiter)
+}
+
+func (enc *ConsoleEncoder) appendSpace(dst []byte) []byte {
+	if len(dst) == 0 || dst[len(dst)-1] == endDelimiter {
+		return dst
+	}
+	return append(dst, ' ')
+}
+
+// appendKeyValue appends b as is, or quoted if it would be ambiguous as a key or a value.
+func appendKeyValue(dst, b []byte) []byte {
+	if !needsQuote(b) {
+		return append(dst, b...)
+	}
+	dst = append(dst, valueWrapper)
+	dst = encode.AppendBytes(dst, b, false)
+	return append(dst, valueWrapper)
+}
+
+func needsQuote(b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+	for _, c := range b {
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+			return true
+		}
+	}
+	return !utf8.Valid(b)
+}
+
+// hasControl reports the control characters and invalid UTF-8 of s, escaped by encode.AppendString.
+func hasControl(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c == 0x7f {
+			return true
+		}
+	}
+	return !utf8.ValidString(s)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -2,8 +2,10 @@ package encode
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"strconv"
+	"sync"
 
 	"github.com/tanzy2018/simplelog/internal"
 )
@@ -88,7 +90,7 @@ func (e emptyStrImeta) IsNil() bool {
 
 // EmptyStrMeta ..
 func EmptyStrMeta(key string) Meta {
-	return emptyStrImeta(key)
+	return valueMeta(emptyStrImeta(key))
 }
 
 // Int ...
@@ -99,22 +101,22 @@ func Int(key string, val int) Meta {
 // Ints ...
 func Ints(key string, ints []int) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*11)
 	vals = append(vals, '[')
 	vals = strconv.AppendInt(vals, int64(ints[0]), 10)
 	if len(ints) > 1 {
-		for _, v := range ints {
+		for _, v := range ints[1:] {
 			vals = append(vals, ',')
 			vals = strconv.AppendInt(vals, int64(v), 10)
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Int8 ...
@@ -125,7 +127,7 @@ func Int8(key string, val int8) Meta {
 // Int8s ...
 func Int8s(key string, ints []int8) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*4)
 	vals = append(vals, '[')
@@ -137,10 +139,10 @@ func Int8s(key string, ints []int8) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Int16 ...
@@ -151,7 +153,7 @@ func Int16(key string, val int16) Meta {
 // Int16s ...
 func Int16s(key string, ints []int16) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*6)
 	vals = append(vals, '[')
@@ -164,10 +166,10 @@ func Int16s(key string, ints []int16) Meta {
 	}
 
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Int32 ...
@@ -178,7 +180,7 @@ func Int32(key string, val int32) Meta {
 // Int32s ...
 func Int32s(key string, ints []int32) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*11)
 	vals = append(vals, '[')
@@ -190,24 +192,21 @@ func Int32s(key string, ints []int32) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Int64 ...
 func Int64(key string, val int64) Meta {
-	return imeta{
-		key:   toBytes(key),
-		value: strconv.AppendInt(make([]byte, 0, 10), val, 10),
-	}
+	return Meta{key: key, kind: kindInt64, num: uint64(val)}
 }
 
 // Int64s ...
 func Int64s(key string, ints []int64) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*11)
 	vals = append(vals, '[')
@@ -219,10 +218,10 @@ func Int64s(key string, ints []int64) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Uint ...
@@ -233,7 +232,7 @@ func Uint(key string, val uint) Meta {
 // Uints ...
 func Uints(key string, ints []uint) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2*len(ints)*11)
 	vals = append(vals, '[')
@@ -245,24 +244,21 @@ func Uints(key string, ints []uint) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Uint8 ...
 func Uint8(key string, val uint8) Meta {
-	return imeta{
-		key:   toBytes(key),
-		value: strconv.AppendUint(make([]byte, 0, 3), uint64(val), 10),
-	}
+	return Uint64(key, uint64(val))
 }
 
 // Uint8s ...
 func Uint8s(key string, ints []uint8) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*4)
 	vals = append(vals, '[')
@@ -274,22 +270,15 @@ func Uint8s(key string, ints []uint8) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
-// Bytes ... Will output as string
+// Bytes ... Will output as string, bs is not copied.
 func Bytes(key string, bs []byte) Meta {
-	if len(bs) == 0 {
-		return emptyStrImeta(key)
-	}
-	return imeta{
-		key:   toBytes(key),
-		value: bs,
-		wrap:  true,
-	}
+	return String(key, internal.ToString(bs))
 }
 
 // Uint16 ...
@@ -300,7 +289,7 @@ func Uint16(key string, val uint16) Meta {
 // Uint16s ...
 func Uint16s(key string, ints []uint16) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*6)
 	vals = append(vals, '[')
@@ -312,10 +301,10 @@ func Uint16s(key string, ints []uint16) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Uint32 ...
@@ -326,7 +315,7 @@ func Uint32(key string, val uint32) Meta {
 // Uint32s ...
 func Uint32s(key string, ints []uint32) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*11)
 	vals = append(vals, '[')
@@ -338,24 +327,21 @@ func Uint32s(key string, ints []uint32) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Uint64 ...
 func Uint64(key string, val uint64) Meta {
-	return imeta{
-		key:   toBytes(key),
-		value: strconv.AppendUint(make([]byte, 0, 10), val, 10),
-	}
+	return Meta{key: key, kind: kindUint64, num: val}
 }
 
 // Uint64s ...
 func Uint64s(key string, ints []uint64) Meta {
 	if len(ints) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+len(ints)*11)
 	vals = append(vals, '[')
@@ -367,117 +353,124 @@ func Uint64s(key string, ints []uint64) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
-// Float32 ...
+// Float32 ... in the shortest form which parses back to val, see FloatPolicy for NaN and infinities.
 func Float32(key string, val float32) Meta {
-	return imeta{
-		key:   toBytes(key),
-		value: strconv.AppendFloat(make([]byte, 0, 8), float64(val), 'g', 5, 32),
-	}
+	return floatMeta(key, float64(val), 32)
 }
 
 // Float32s ...
-func Float32s(key string, ints []float32) Meta {
-	if len(ints) == 0 {
-		return emptyArrayImeta(key)
-	}
-	vals := make([]byte, 0, 2+8*len(ints))
-	vals = append(vals, '[')
-	vals = strconv.AppendFloat(vals, float64(ints[0]), 'g', 5, 32)
-	if len(ints) > 1 {
-		for _, f := range ints {
-			vals = append(vals, ',')
-			vals = strconv.AppendFloat(vals, float64(f), 'g', 5, 32)
-		}
-	}
-	vals = append(vals, ']')
-	return imeta{
-		key:   toBytes(key),
-		value: vals,
-	}
+func Float32s(key string, floats []float32) Meta {
+	return floatsMeta(key, len(floats), func(i int) float64 { return float64(floats[i]) }, 32)
 }
 
-// Float64 ...
+// Float64 ... in the shortest form which parses back to val, see FloatPolicy for NaN and infinities.
 func Float64(key string, val float64) Meta {
-	return imeta{
-		key:   toBytes(key),
-		value: strconv.AppendFloat(make([]byte, 0, 8), val, 'g', 5, 64),
-	}
+	return floatMeta(key, val, 64)
 }
 
 // Float64s ...
-func Float64s(key string, ints []float64) Meta {
-	if len(ints) == 0 {
-		return emptyArrayImeta(key)
-	}
-	vals := make([]byte, 0, 2+8*len(ints))
-	vals = append(vals, '[')
-	vals = strconv.AppendFloat(vals, ints[0], 'g', 5, 64)
-	if len(ints) > 1 {
-		for _, v := range ints[1:] {
-			vals = append(vals, ',')
-			vals = strconv.AppendFloat(vals, v, 'g', 5, 64)
-		}
-	}
-
-	vals = append(vals, ']')
-	return imeta{
-		key:   toBytes(key),
-		value: vals,
-	}
+func Float64s(key string, floats []float64) Meta {
+	return floatsMeta(key, len(floats), func(i int) float64 { return floats[i] }, 64)
 }
 
-// String ...
+// String ... The value is escaped when it is written to the record.
 func String(key string, val string) Meta {
-	return imeta{
-		key:   toBytes(key),
-		value: toBytes(val),
-		wrap:  true,
+	return Meta{key: key, kind: kindString, str: val}
+}
+
+type stringerImeta struct {
+	key   string
+	v     fmt.Stringer
+	once  sync.Once
+	value []byte
+}
+
+func (s *stringerImeta) Key() []byte {
+	return toBytes(s.key)
+}
+
+func (s *stringerImeta) Value() []byte {
+	s.once.Do(func() {
+		s.value = toBytes(safeString(s.v))
+	})
+	return s.value
+}
+
+func (s *stringerImeta) Wrap() bool {
+	return true
+}
+
+func (s *stringerImeta) IsNil() bool {
+	return false
+}
+
+// Stringer ... v.String(), which is only called when the record is written,
+// so it costs nothing if the level is disabled. A nil v is null.
+func Stringer(key string, v fmt.Stringer) Meta {
+	if v == nil {
+		return valueMeta(nullImeta(key))
 	}
+	return valueMeta(&stringerImeta{key: key, v: v})
+}
+
+// safeString calls v.String(), recovering from the panic of a nil pointer receiver.
+func safeString(v fmt.Stringer) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+				s = "<nil>"
+				return
+			}
+			s = fmt.Sprintf("<PANIC=%v>", r)
+		}
+	}()
+	return v.String()
 }
 
 // Strings ...
 func Strings(key string, strs []string) Meta {
 	if len(strs) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2)
 	vals = append(vals, '[')
 	vals = append(vals, '"')
-	vals = append(vals, toBytes(strs[0])...)
+	vals = AppendString(vals, strs[0], false)
 	vals = append(vals, '"')
 	if len(strs) > 1 {
 		for i := 1; i < len(strs); i++ {
 			vals = append(vals, ',')
 			vals = append(vals, '"')
-			vals = append(vals, toBytes(strs[i])...)
+			vals = AppendString(vals, strs[i], false)
 			vals = append(vals, '"')
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 // Bool ...
 func Bool(key string, b bool) Meta {
-	return imeta{
-		key:   toBytes(key),
-		value: toBytes(strconv.FormatBool(b)),
+	m := Meta{key: key, kind: kindBool}
+	if b {
+		m.num = 1
 	}
+	return m
 }
 
 // Bools ...
 func Bools(key string, bs []bool) Meta {
 	if len(bs) == 0 {
-		return emptyArrayImeta(key)
+		return valueMeta(emptyArrayImeta(key))
 	}
 	vals := make([]byte, 0, 2+6*len(bs))
 	vals = append(vals, '[')
@@ -489,21 +482,21 @@ func Bools(key string, bs []bool) Meta {
 		}
 	}
 	vals = append(vals, ']')
-	return imeta{
+	return valueMeta(imeta{
 		key:   toBytes(key),
 		value: vals,
-	}
+	})
 }
 
 func any(key string, val interface{}) Meta {
 	if val == nil {
-		return nullImeta(key)
+		return valueMeta(nullImeta(key))
 	}
 
 	v := reflect.ValueOf(val)
 	if v.Kind() == reflect.Ptr {
 		if !v.Elem().IsValid() {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		v = reflect.ValueOf(v.Elem().Interface())
 	}
@@ -512,105 +505,70 @@ func any(key string, val interface{}) Meta {
 	if kind == reflect.Struct {
 		buf, err := json.Marshal(v.Interface())
 		if err != nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
-		return imeta{
+		return valueMeta(imeta{
 			key:   toBytes(key),
 			value: buf,
-		}
+		})
 	}
 
 	if kind == reflect.Map {
 		if v.IsNil() {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		buf, err := json.Marshal(v.Interface())
 		if err != nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
-		return imeta{
+		return valueMeta(imeta{
 			key:   toBytes(key),
 			value: buf,
-		}
+		})
 	}
 
 	if kind == reflect.Slice {
 		if v.IsNil() || v.Len() == 0 {
-			return emptyArrayImeta(key)
-		}
-
-		buf := make([]byte, 0, 2)
-		buf = append(buf, '[')
-
-		md := Any("", v.Index(0).Interface())
-		if md.Wrap() {
-			buf = append(buf, '"')
-			buf = append(buf, md.Value()...)
-			buf = append(buf, '"')
-		} else {
-			buf = append(buf, md.Value()...)
-		}
-
-		for i := 1; i < v.Len(); i++ {
-			buf = append(buf, ',')
-			md := Any("", v.Index(i).Interface())
-			if md.Wrap() {
-				buf = append(buf, '"')
-				buf = append(buf, md.Value()...)
-				buf = append(buf, '"')
-			} else {
-				buf = append(buf, md.Value()...)
-			}
-		}
-
-		buf = append(buf, ']')
-		return imeta{
-			key:   toBytes(key),
-			value: buf,
+			return valueMeta(emptyArrayImeta(key))
 		}
+		return anyArray(key, v)
 	}
 
 	if kind == reflect.Array {
 		if v.Len() == 0 {
-			return emptyArrayImeta(key)
-		}
-
-		buf := make([]byte, 0, 2)
-		buf = append(buf, '[')
-		md := Any("", v.Index(0).Interface())
-		if md.Wrap() {
-			buf = append(buf, '"')
-			buf = append(buf, md.Value()...)
-			buf = append(buf, '"')
-		} else {
-			buf = append(buf, md.Value()...)
-		}
-
-		for i := 1; i < v.Len(); i++ {
-			buf = append(buf, ',')
-			md := Any("", v.Index(i).Interface())
-			if md.Wrap() {
-				buf = append(buf, '"')
-				buf = append(buf, md.Value()...)
-				buf = append(buf, '"')
-			} else {
-				buf = append(buf, md.Value()...)
-			}
-		}
-		buf = append(buf, ']')
-		return imeta{
-			key:   toBytes(key),
-			value: buf,
+			return valueMeta(emptyArrayImeta(key))
 		}
+		return anyArray(key, v)
 	}
-	return nullImeta(key)
+	return valueMeta(nullImeta(key))
+}
+
+func anyArray(key string, v reflect.Value) Meta {
+	md := make([]Meta, v.Len())
+	for i := range md {
+		md[i] = Any("", v.Index(i).Interface())
+	}
+	if n, ok := firstNonFinite(md); ok {
+		return valueMeta(nonFiniteImeta{key: key, first: n.first, appendValue: func(dst []byte, p FloatPolicy) []byte {
+			return arrayImeta{md: md}.appendValue(dst, elementPolicy(p))
+		}})
+	}
+	return valueMeta(imeta{
+		key:   toBytes(key),
+		value: arrayImeta{md: md}.AppendValue(make([]byte, 0, 2+8*len(md))),
+	})
 }
 
-// Any ...
+// Any ... ObjectMarshaler and ArrayMarshaler are encoded by themselves,
+// other structs and maps fall back to json.Marshal.
 func Any(key string, val interface{}) Meta {
 	switch val.(type) {
 	default:
 		return any(key, val)
+	case ObjectMarshaler:
+		return MarshalObject(key, val.(ObjectMarshaler))
+	case ArrayMarshaler:
+		return MarshalArray(key, val.(ArrayMarshaler))
 	case int:
 		return Int(key, val.(int))
 	case int32:
@@ -643,85 +601,85 @@ func Any(key string, val interface{}) Meta {
 	case *int:
 		v := val.(*int)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Int(key, *v)
 	case *int8:
 		v := val.(*int8)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Int8(key, *v)
 	case *int16:
 		v := val.(*int16)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Int16(key, *v)
 	case *int32:
 		v := val.(*int32)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Int32(key, *v)
 	case *int64:
 		v := val.(*int64)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Int64(key, *v)
 	case *uint:
 		v := val.(*uint)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Uint(key, *v)
 	case *uint8:
 		v := val.(*uint8)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Uint8(key, *v)
 	case *uint16:
 		v := val.(*uint16)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Uint16(key, *v)
 	case *uint32:
 		v := val.(*uint32)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Uint32(key, *v)
 	case *uint64:
 		v := val.(*uint64)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Uint64(key, *v)
 	case *float32:
 		v := val.(*float32)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Float32(key, *v)
 	case *float64:
 		v := val.(*float64)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Float64(key, *v)
 	case *string:
 		v := val.(*string)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return String(key, *v)
 	case *bool:
 		v := val.(*bool)
 		if v == nil {
-			return nullImeta(key)
+			return valueMeta(nullImeta(key))
 		}
 		return Bool(key, *v)
 	}
@@ -1,8 +1,12 @@
 package encode
 
 import (
-	"reflect"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestAny(t *testing.T) {
@@ -54,7 +58,7 @@ func TestAny(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want Meta
+		want metaValue
 	}{
 		// int*
 		{"Int_0", args{"int_0", int(1)}, imeta{[]byte("int_0"), []byte("1"), false}},
@@ -264,7 +268,7 @@ func TestAny(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := Any(tt.args.key, tt.args.any); !reflect.DeepEqual(got, tt.want) {
+			if got := Any(tt.args.key, tt.args.any); !metaEqual(got, valueMeta(tt.want)) {
 				t.Errorf("Actual =%s,%s\n, want %s,%s", got.Key(), got.Value(), tt.want.Key(), tt.want.Value())
 				t.Errorf("Actual = %#v, want %#v", got, tt.want)
 			}
@@ -272,6 +276,12 @@ func TestAny(t *testing.T) {
 	}
 }
 
+// metaEqual compares what a Meta encodes, whatever its type.
+func metaEqual(got, want Meta) bool {
+	return bytes.Equal(got.Key(), want.Key()) && bytes.Equal(got.Value(), want.Value()) &&
+		got.Wrap() == want.Wrap() && got.IsNil() == want.IsNil()
+}
+
 type TestAnyStruct struct {
 	Name    string
 	Age     int32
@@ -284,3 +294,262 @@ type TestAnyStruct struct {
 	Pets    []string
 	Extra   []interface{}
 }
+
+func TestAppendString(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		escapeHTML bool
+		want       string
+	}{
+		{"plain", "abc 中文", false, "abc 中文"},
+		{"quote", `say "hi"`, false, `say \"hi\"`},
+		{"backslash", `a\b`, false, `a\\b`},
+		{"newline", "a\nb\r\tc", false, `a\nb\r\tc`},
+		{"control", "\x00\x1f\b\f", false, `\u0000\u001f\b\f`},
+		{"invalid_utf8", "a\xffb", false, `a\ufffdb`},
+		{"line_separator", "a\u2028b\u2029", false, `a\u2028b\u2029`},
+		{"html_off", "<a>&", false, "<a>&"},
+		{"html_on", "<a>&", true, `\u003ca\u003e\u0026`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(AppendString(nil, tt.in, tt.escapeHTML)); got != tt.want {
+				t.Errorf("Actual = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInts(t *testing.T) {
+	if got, want := Ints("ints", []int{1, -2, 3}).Value(), "[1,-2,3]"; string(got) != want {
+		t.Errorf("Actual = %s, want %s", got, want)
+	}
+}
+
+func TestStringsEscape(t *testing.T) {
+	got := Strings("strs", []string{`"a"`, "b\n"})
+	if want := `["\"a\"","b\n"]`; string(got.Value()) != want {
+		t.Errorf("Actual = %s, want %s", got.Value(), want)
+	}
+}
+
+func TestHTMLEscape(t *testing.T) {
+	dst := []byte(`"k":`)
+	got := HTMLEscape(Object("obj", String("<a>", "b&c")).AppendValue(dst), len(dst))
+	if want := `"k":{"\u003ca\u003e":"b\u0026c"}`; string(got) != want {
+		t.Errorf("Actual = %s, want %s", got, want)
+	}
+}
+
+type testRequest struct {
+	Method string
+	Status int
+}
+
+func (r *testRequest) MarshalLogObject(enc *ObjectEncoder) {
+	enc.Add(String("method", r.Method), Int("status", r.Status))
+}
+
+type testRequests []*testRequest
+
+func (rs testRequests) MarshalLogArray(enc *ArrayEncoder) {
+	for _, r := range rs {
+		enc.Append(MarshalObject("", r))
+	}
+}
+
+func TestObject(t *testing.T) {
+	tests := []struct {
+		name string
+		md   Meta
+		want string
+	}{
+		{"Object_empty", Object("obj"), `{}`},
+		{"Object_flat", Object("http", String("method", "GET"), Int("status", 200)), `{"method":"GET","status":200}`},
+		{"Object_nested", Object("a", Object("b", Bool("c", true)), Ints("d", []int{1, 2})), `{"b":{"c":true},"d":[1,2]}`},
+		{"Object_escape", Object("obj", String("k\"", "v\n")), `{"k\"":"v\n"}`},
+		{"Array_empty", Array("arr"), `[]`},
+		{"Array_values", Array("arr", Int("", 1), String("", "a"), Any("", nil)), `[1,"a",null]`},
+		{"Array_objects", Array("users", Object("", String("name", "Tom")), Object("", String("name", "Jeiry"))), `[{"name":"Tom"},{"name":"Jeiry"}]`},
+		{"MarshalObject", MarshalObject("req", &testRequest{"GET", 200}), `{"method":"GET","status":200}`},
+		{"MarshalObject_nil", MarshalObject("req", nil), `null`},
+		{"MarshalObject_typed_nil", MarshalObject("req", (*testRequest)(nil)), `null`},
+		{"MarshalArray_typed_nil", MarshalArray("reqs", (*testRequests)(nil)), `null`},
+		{"Any_typed_nil_ObjectMarshaler", Any("req", (*testRequest)(nil)), `null`},
+		{"Any_typed_nil_ArrayMarshaler", Any("reqs", (*testRequests)(nil)), `null`},
+		{"MarshalArray", MarshalArray("reqs", testRequests{{"GET", 200}, {"PUT", 400}}), `[{"method":"GET","status":200},{"method":"PUT","status":400}]`},
+		{"Any_ObjectMarshaler", Any("req", &testRequest{"GET", 200}), `{"method":"GET","status":200}`},
+		{"Any_ArrayMarshaler", Any("reqs", testRequests{}), `[]`},
+		{"Any_slice_of_ObjectMarshaler", Any("reqs", []*testRequest{{"GET", 200}}), `[{"method":"GET","status":200}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.md.Value()); got != tt.want {
+				t.Errorf("Actual = %s, want %s", got, tt.want)
+			}
+			if got := string(tt.md.AppendValue([]byte("prefix:"))); got != "prefix:"+tt.want {
+				t.Errorf("AppendValue Actual = %s, want prefix:%s", got, tt.want)
+			}
+		})
+	}
+}
+
+type verboseErr struct{}
+
+func (e verboseErr) Error() string {
+	return "failed"
+}
+
+func (e verboseErr) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprint(s, "failed\nmain.go:10")
+		return
+	}
+	fmt.Fprint(s, e.Error())
+}
+
+type countingStringer struct {
+	calls int
+}
+
+func (c *countingStringer) String() string {
+	c.calls++
+	return "called"
+}
+
+type nilStringer struct {
+	name string
+}
+
+func (n *nilStringer) String() string {
+	return n.name
+}
+
+func TestTypedMeta(t *testing.T) {
+	at := time.Date(2020, 8, 11, 10, 28, 18, 500000000, time.UTC)
+	tests := []struct {
+		name     string
+		md       Meta
+		wantWrap bool
+		want     string
+	}{
+		{"Time", Time("t", at), true, "2020-08-11T10:28:18.5Z"},
+		{"TimeLayout", TimeLayout("t", at, "2006-01-02"), true, "2020-08-11"},
+		{"TimeLayout_unix", TimeLayout("t", at, UnixLayout), false, "1597141698"},
+		{"TimeLayout_unixmilli", TimeLayout("t", at, UnixMilliLayout), false, "1597141698500"},
+		{"TimeLayout_unixmicro", TimeLayout("t", at, UnixMicroLayout), false, "1597141698500000"},
+		{"TimeLayout_unixnano", TimeLayout("t", at, UnixNanoLayout), false, "1597141698500000000"},
+		{"Duration", Duration("d", 1500*time.Millisecond), true, "1.5s"},
+		{"Duration_nanos", DurationAs("d", 1500*time.Millisecond, DurationNanos), false, "1500000000"},
+		{"Duration_millis", DurationAs("d", 1500*time.Millisecond, DurationMillis), false, "1500"},
+		{"Duration_seconds", DurationAs("d", 1500*time.Millisecond, DurationSeconds), false, "1.5"},
+		{"NamedErr", NamedErr("cause", errors.New("failed")), true, "failed"},
+		{"NamedErr_nil", NamedErr("cause", nil), true, ""},
+		{"Stringer", Stringer("s", time.Second), true, "1s"},
+		{"Stringer_nil_pointer", Stringer("s", (*nilStringer)(nil)), true, "<nil>"},
+		{"Stringer_nil", Stringer("s", nil), false, "null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.md.Value()); got != tt.want || tt.md.Wrap() != tt.wantWrap {
+				t.Errorf("Actual = %s,%v, want %s,%v", got, tt.md.Wrap(), tt.want, tt.wantWrap)
+			}
+		})
+	}
+}
+
+func TestNamedErrVerbose(t *testing.T) {
+	g := NamedErr("cause", verboseErr{})
+	if len(g.Metas()) == 0 {
+		t.Fatal("NamedErr should expand into its fields")
+	}
+	got := Object("", g).Value()
+	if want := `{"cause":"failed","causeVerbose":"failed\nmain.go:10"}`; string(got) != want {
+		t.Errorf("Actual = %s, want %s", got, want)
+	}
+	if md := NamedErr("cause", errors.New("plain")).Metas(); len(md) != 1 {
+		t.Errorf("expected no verbose field for a plain error, actual %d fields", len(md))
+	}
+}
+
+func TestStringerIsLazy(t *testing.T) {
+	c := &countingStringer{}
+	md := Stringer("s", c)
+	if c.calls != 0 {
+		t.Fatalf("String should not be called before the value is needed")
+	}
+	md.Value()
+	md.Value()
+	if c.calls != 1 {
+		t.Errorf("String should be called once, actual %d", c.calls)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	tests := []struct {
+		name     string
+		md       Meta
+		wantWrap bool
+		want     string
+		wantNull string
+	}{
+		{"Float32_shortest", Float32("f", 0.1), false, "0.1", "0.1"},
+		{"Float32_precision", Float32("f", 123456.7), false, "123456.7", "123456.7"},
+		{"Float64_shortest", Float64("f", 0.1), false, "0.1", "0.1"},
+		{"Float64_precision", Float64("f", 1234567.891), false, "1234567.891", "1234567.891"},
+		{"Float64_large", Float64("f", 1e21), false, "1e+21", "1e+21"},
+		{"Float64_small", Float64("f", 1e-7), false, "1e-7", "1e-7"},
+		{"Float64_NaN", Float64("f", nan), true, "NaN", "null"},
+		{"Float64_+Inf", Float64("f", inf), true, "+Inf", "null"},
+		{"Float32_-Inf", Float32("f", float32(math.Inf(-1))), true, "-Inf", "null"},
+		{"Float32s", Float32s("f", []float32{1, 0.1, -2}), false, "[1,0.1,-2]", "[1,0.1,-2]"},
+		{"Float32s_NaN", Float32s("f", []float32{1, float32(nan)}), false, `[1,"NaN"]`, "[1,null]"},
+		{"Float64s_Inf", Float64s("f", []float64{inf, 2}), false, `["+Inf",2]`, "[null,2]"},
+		{"Any_slice_NaN", Any("f", []interface{}{1, nan, "a"}), false, `[1,"NaN","a"]`, `[1,null,"a"]`},
+		{"Any_array_nested_Inf", Any("f", [1][]float64{{inf}}), false, `[["+Inf"]]`, `[[null]]`},
+		{"Object_NaN", Object("f", Float64("x", nan), Int("y", 1)), false, `{"x":"NaN","y":1}`, `{"x":null,"y":1}`},
+		{"Array_NaN", Array("f", Float64("", nan)), false, `["NaN"]`, `[null]`},
+		{"MarshalObject_NaN", MarshalObject("f", testFloats{nan, 1}), false, `{"x":"NaN","y":1,"xs":["NaN",1]}`, `{"x":null,"y":1,"xs":[null,1]}`},
+		{"MarshalArray_Inf", MarshalArray("f", testFloats{inf}), false, `["+Inf"]`, `[null]`},
+		{"Object_MarshalObject_NaN", Object("f", MarshalObject("o", testFloats{nan, 1})), false, `{"o":{"x":"NaN","y":1,"xs":["NaN",1]}}`, `{"o":{"x":null,"y":1,"xs":[null,1]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.md.Value()); got != tt.want || tt.md.Wrap() != tt.wantWrap {
+				t.Errorf("Actual = %s,%v, want %s,%v", got, tt.md.Wrap(), tt.want, tt.wantWrap)
+			}
+			if got := string(ApplyFloatPolicy(tt.md, FloatAsNull).Value()); got != tt.wantNull {
+				t.Errorf("FloatAsNull Actual = %s, want %s", got, tt.wantNull)
+			}
+		})
+	}
+}
+
+type testFloats []float64
+
+func (fs testFloats) MarshalLogObject(enc *ObjectEncoder) {
+	enc.Add(Float64("x", fs[0]), Float64("y", fs[1]), MarshalArray("xs", fs))
+}
+
+func (fs testFloats) MarshalLogArray(enc *ArrayEncoder) {
+	for _, f := range fs {
+		enc.Append(Float64("", f))
+	}
+}
+
+func TestFloatAsError(t *testing.T) {
+	got := Object("", ApplyFloatPolicy(Float64s("f", []float64{1, math.NaN()}), FloatAsError)).Value()
+	if want := `{"f":[1,null],"fError":"unsupported float value NaN"}`; string(got) != want {
+		t.Errorf("Actual = %s, want %s", got, want)
+	}
+	// the floats of a marshaler are only known once encoded, too late for the error field.
+	got = Object("", ApplyFloatPolicy(MarshalObject("o", testFloats{math.NaN(), 1}), FloatAsError)).Value()
+	if want := `{"o":{"x":null,"y":1,"xs":[null,1]}}`; string(got) != want {
+		t.Errorf("Actual = %s, want %s", got, want)
+	}
+	if md := ApplyFloatPolicy(Float64("f", 1), FloatAsError); string(md.Value()) != "1" {
+		t.Errorf("finite floats should not be changed, actual %s", md.Value())
+	}
+}
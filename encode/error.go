@@ -0,0 +1,47 @@
+package encode
+
+import (
+	"fmt"
+)
+
+type errImeta struct {
+	key string
+	err error
+}
+
+func (e errImeta) Key() []byte {
+	return toBytes(e.key)
+}
+
+func (e errImeta) Value() []byte {
+	return toBytes(e.err.Error())
+}
+
+func (e errImeta) Wrap() bool {
+	return true
+}
+
+func (e errImeta) IsNil() bool {
+	return false
+}
+
+func (e errImeta) Metas() []Meta {
+	basic := e.err.Error()
+	md := []Meta{String(e.key, basic)}
+	if _, ok := e.err.(fmt.Formatter); ok {
+		if verbose := fmt.Sprintf("%+v", e.err); verbose != basic {
+			md = append(md, String(e.key+"Verbose", verbose))
+		}
+	}
+	return md
+}
+
+// NamedErr ... err.Error() under key. If err implements fmt.Formatter, like the errors
+// of github.com/pkg/errors, its "%+v" form is added under key+"Verbose" when it says more.
+// A nil err is an empty string.
+func NamedErr(key string, err error) Meta {
+	if err == nil {
+		return valueMeta(emptyStrImeta(key))
+	}
+	return valueMeta(errImeta{key: key, err: err})
+}
@@ -0,0 +1,105 @@
+package encode
+
+import (
+	"unicode/utf8"
+
+	"github.com/tanzy2018/simplelog/internal"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// AppendString appends s to dst as the content of a JSON string (without the quotes),
+// escaped as required by RFC 8259. Invalid UTF-8 bytes are replaced by U+FFFD.
+// If escapeHTML is true, '<', '>' and '&' are escaped as well,
+// so that the output is safe to embed in HTML.
+func AppendString(dst []byte, s string, escapeHTML bool) []byte {
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if isSafe(b, escapeHTML) {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are valid JSON but break JavaScript parsers.
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	return append(dst, s[start:]...)
+}
+
+// AppendBytes is the same as AppendString but takes a byte slice.
+func AppendBytes(dst []byte, b []byte, escapeHTML bool) []byte {
+	return AppendString(dst, internal.ToString(b), escapeHTML)
+}
+
+func isSafe(b byte, escapeHTML bool) bool {
+	if b < 0x20 || b == '"' || b == '\\' {
+		return false
+	}
+	if escapeHTML && isHTML(b) {
+		return false
+	}
+	return true
+}
+
+// HTMLEscape escapes '<', '>' and '&' in dst[start:], a JSON value encoded without escapeHTML,
+// such as the arrays and objects, whose strings are encoded ahead of the encoder. Outside its strings
+// a JSON value holds none of them, so that they are escaped as AppendString does, like json.HTMLEscape.
+func HTMLEscape(dst []byte, start int) []byte {
+	i := start
+	for i < len(dst) && !isHTML(dst[i]) {
+		i++
+	}
+	if i == len(dst) {
+		return dst
+	}
+	tail := append([]byte(nil), dst[i:]...)
+	dst = dst[:i]
+	for _, b := range tail {
+		if isHTML(b) {
+			dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			continue
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+func isHTML(b byte) bool {
+	return b == '<' || b == '>' || b == '&'
+}
@@ -0,0 +1,208 @@
+package encode
+
+import (
+	"math"
+	"strconv"
+)
+
+// FloatPolicy ... how the floats JSON cannot represent, NaN, +Inf and -Inf, are encoded.
+type FloatPolicy int
+
+const (
+	// FloatAsString ... the strings "NaN", "+Inf" and "-Inf", the default.
+	FloatAsString FloatPolicy = iota
+	// FloatAsNull ... null.
+	FloatAsNull
+	// FloatAsError ... null, and a sibling field key+"Error" reports the unsupported value.
+	// The floats added by an ObjectMarshaler or an ArrayMarshaler are encoded as null
+	// without the error, since they are only known once the value is encoded.
+	FloatAsError
+)
+
+// nonFiniteImeta holds at least one NaN or infinite float, it is encoded per FloatAsString
+// unless ApplyFloatPolicy picks another policy.
+type nonFiniteImeta struct {
+	key string
+	// scalar is a single float, wrapped as a string per FloatAsString.
+	scalar bool
+	// first is the first non-finite float, reported by FloatAsError.
+	first float64
+	// appendValue appends the value with the non-finite floats encoded per the policy.
+	appendValue func(dst []byte, p FloatPolicy) []byte
+}
+
+func (n nonFiniteImeta) Key() []byte {
+	return toBytes(n.key)
+}
+
+func (n nonFiniteImeta) Value() []byte {
+	if n.scalar {
+		return toBytes(nonFiniteString(n.first))
+	}
+	return n.appendValue(nil, FloatAsString)
+}
+
+func (n nonFiniteImeta) Wrap() bool {
+	return n.scalar
+}
+
+func (n nonFiniteImeta) IsNil() bool {
+	return false
+}
+
+type groupImeta []Meta
+
+func (g groupImeta) Key() []byte {
+	return g[0].Key()
+}
+
+func (g groupImeta) Value() []byte {
+	return g[0].Value()
+}
+
+func (g groupImeta) Wrap() bool {
+	return g[0].Wrap()
+}
+
+func (g groupImeta) IsNil() bool {
+	return g[0].IsNil()
+}
+
+func (g groupImeta) Metas() []Meta {
+	return g
+}
+
+// ApplyFloatPolicy ... md with its NaN and infinite floats encoded per p.
+// md is returned as is if it holds none of them, or if p is FloatAsString.
+// It applies to Float32, Float64, Float32s, Float64s, Object, Array, MarshalObject, MarshalArray
+// and the slices and arrays of Any.
+func ApplyFloatPolicy(md Meta, p FloatPolicy) Meta {
+	if p == FloatAsString {
+		return md
+	}
+	// the objects and arrays may hold marshalers, whose floats are only known once encoded.
+	switch m := md.v.(type) {
+	case objectImeta:
+		m.policy = p
+		return valueMeta(m)
+	case arrayImeta:
+		m.policy = p
+		return valueMeta(m)
+	case objectMarshalerImeta:
+		m.policy = p
+		return valueMeta(m)
+	case arrayMarshalerImeta:
+		m.policy = p
+		return valueMeta(m)
+	}
+	n, ok := md.v.(nonFiniteImeta)
+	if !ok {
+		return md
+	}
+	value := valueMeta(nullImeta(n.key))
+	if !n.scalar {
+		value = valueMeta(imeta{key: toBytes(n.key), value: n.appendValue(nil, FloatAsNull)})
+	}
+	if p != FloatAsError {
+		return value
+	}
+	return valueMeta(groupImeta{value, String(n.key+"Error", "unsupported float value "+nonFiniteString(n.first))})
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func nonFiniteString(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return "NaN"
+}
+
+// appendFloat appends f in the shortest form which parses back to the same float of the given bits,
+// like encoding/json does, with the non-finite floats encoded per p.
+func appendFloat(dst []byte, f float64, bits int, p FloatPolicy) []byte {
+	if !isFinite(f) {
+		if p != FloatAsString {
+			return append(dst, "null"...)
+		}
+		dst = append(dst, '"')
+		dst = append(dst, nonFiniteString(f)...)
+		return append(dst, '"')
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+func floatMeta(key string, f float64, bits int) Meta {
+	if !isFinite(f) {
+		return valueMeta(nonFiniteImeta{key: key, scalar: true, first: f})
+	}
+	kind := kindFloat64
+	if bits == 32 {
+		kind = kindFloat32
+	}
+	return Meta{key: key, kind: kind, num: math.Float64bits(f)}
+}
+
+func floatsMeta(key string, n int, at func(i int) float64, bits int) Meta {
+	if n == 0 {
+		return valueMeta(emptyArrayImeta(key))
+	}
+	appendValue := func(dst []byte, p FloatPolicy) []byte {
+		dst = append(dst, '[')
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendFloat(dst, at(i), bits, p)
+		}
+		return append(dst, ']')
+	}
+	for i := 0; i < n; i++ {
+		if f := at(i); !isFinite(f) {
+			return valueMeta(nonFiniteImeta{key: key, first: f, appendValue: appendValue})
+		}
+	}
+	return valueMeta(imeta{
+		key:   toBytes(key),
+		value: appendValue(make([]byte, 0, 2+8*n), FloatAsString),
+	})
+}
+
+// firstNonFinite returns the first of md holding a non-finite float.
+func firstNonFinite(md []Meta) (nonFiniteImeta, bool) {
+	for _, m := range md {
+		if n, ok := m.v.(nonFiniteImeta); ok {
+			return n, true
+		}
+	}
+	return nonFiniteImeta{}, false
+}
+
+// elementPolicy is the policy of the elements of an array or an object,
+// the error of FloatAsError is reported once for the whole value.
+func elementPolicy(p FloatPolicy) FloatPolicy {
+	if p == FloatAsError {
+		return FloatAsNull
+	}
+	return p
+}
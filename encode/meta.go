@@ -1,9 +1,122 @@
 package encode
 
-// Meta ...
-type Meta interface {
+import (
+	"math"
+	"strconv"
+)
+
+// Meta ... a field of a record. The typed fields, such as Int, Uint64, Float64, Bool and String,
+// are held in place, so that a Meta is passed to a Log by value without any allocation.
+// The zero Meta is no field, see IsZero.
+type Meta struct {
+	key  string
+	kind metaKind
+	// num holds the bits of the numbers and bools, str the strings.
+	num uint64
+	str string
+	// v holds the value of the other fields.
+	v metaValue
+}
+
+type metaKind uint8
+
+const (
+	kindNone metaKind = iota
+	kindInt64
+	kindUint64
+	kindFloat32
+	kindFloat64
+	kindBool
+	kindString
+	kindValue
+)
+
+// metaValue ... the fields other than the typed ones, held by a Meta.
+type metaValue interface {
 	Key() []byte
 	Value() []byte
 	Wrap() bool
 	IsNil() bool
 }
+
+// group ... implemented by the metaValue which expand into several sibling fields, such as NamedErr.
+type group interface {
+	Metas() []Meta
+}
+
+func valueMeta(v metaValue) Meta {
+	return Meta{kind: kindValue, v: v}
+}
+
+// Key ...
+func (m Meta) Key() []byte {
+	if m.kind == kindValue {
+		return m.v.Key()
+	}
+	return toBytes(m.key)
+}
+
+// Value ... unescaped if Wrap. AppendValue spares the allocation of the numbers and bools.
+func (m Meta) Value() []byte {
+	switch m.kind {
+	case kindString:
+		return toBytes(m.str)
+	case kindValue:
+		return m.v.Value()
+	}
+	return m.AppendValue(nil)
+}
+
+// AppendValue ... appends Value to dst.
+func (m Meta) AppendValue(dst []byte) []byte {
+	switch m.kind {
+	case kindInt64:
+		return strconv.AppendInt(dst, int64(m.num), 10)
+	case kindUint64:
+		return strconv.AppendUint(dst, m.num, 10)
+	case kindFloat32:
+		return appendFloat(dst, math.Float64frombits(m.num), 32, FloatAsString)
+	case kindFloat64:
+		return appendFloat(dst, math.Float64frombits(m.num), 64, FloatAsString)
+	case kindBool:
+		return strconv.AppendBool(dst, m.num != 0)
+	case kindString:
+		return append(dst, m.str...)
+	case kindValue:
+		if va, ok := m.v.(ValueAppender); ok {
+			return va.AppendValue(dst)
+		}
+		return append(dst, m.v.Value()...)
+	}
+	return dst
+}
+
+// Wrap ... whether the value is a string, to be quoted and escaped.
+func (m Meta) Wrap() bool {
+	switch m.kind {
+	case kindString:
+		return true
+	case kindValue:
+		return m.v.Wrap()
+	}
+	return false
+}
+
+// IsNil ... whether the value is null.
+func (m Meta) IsNil() bool {
+	return m.kind == kindValue && m.v.IsNil()
+}
+
+// IsZero ... whether m is the zero Meta, which is no field.
+func (m Meta) IsZero() bool {
+	return m.kind == kindNone
+}
+
+// Metas ... the sibling fields m expands into, such as by NamedErr, nil for the other fields.
+// Key and Value of m are the ones of its first field, for the encoders which do not expand it.
+func (m Meta) Metas() []Meta {
+	if g, ok := m.v.(group); ok {
+		return g.Metas()
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package encode
+
+import "reflect"
+
+// ValueAppender ... implemented by Meta and the values it holds which append their value
+// to dst directly, sparing the allocation of Value.
+type ValueAppender interface {
+	AppendValue(dst []byte) []byte
+}
+
+// ObjectMarshaler ... implemented by the types which add their own fields to an object, without reflection:
+//
+//	func (r *Request) MarshalLogObject(enc *encode.ObjectEncoder) {
+//		enc.Add(encode.String("method", r.Method), encode.Int("status", r.Status))
+//	}
+type ObjectMarshaler interface {
+	MarshalLogObject(enc *ObjectEncoder)
+}
+
+// ArrayMarshaler ... implemented by the types which append their own elements to an array, without reflection.
+type ArrayMarshaler interface {
+	MarshalLogArray(enc *ArrayEncoder)
+}
+
+// ObjectEncoder ... the fields of an object being encoded.
+type ObjectEncoder struct {
+	buf []byte
+	// policy is the FloatPolicy of the Log, carried by ApplyFloatPolicy.
+	policy FloatPolicy
+}
+
+// Add ... adds the fields md to the object.
+func (enc *ObjectEncoder) Add(md ...Meta) {
+	for _, m := range md {
+		m = ApplyFloatPolicy(m, enc.policy)
+		if g := m.Metas(); g != nil {
+			enc.Add(g...)
+			continue
+		}
+		if last := enc.buf[len(enc.buf)-1]; last != '{' {
+			enc.buf = append(enc.buf, ',')
+		}
+		enc.buf = appendField(enc.buf, m)
+	}
+}
+
+// ArrayEncoder ... the elements of an array being encoded.
+type ArrayEncoder struct {
+	buf []byte
+	// policy is the FloatPolicy of the Log, carried by ApplyFloatPolicy.
+	policy FloatPolicy
+}
+
+// Append ... appends the values of md to the array, their keys are ignored.
+func (enc *ArrayEncoder) Append(md ...Meta) {
+	for _, m := range md {
+		m = ApplyFloatPolicy(m, enc.policy)
+		if last := enc.buf[len(enc.buf)-1]; last != '[' {
+			enc.buf = append(enc.buf, ',')
+		}
+		enc.buf = appendValue(enc.buf, m)
+	}
+}
+
+type objectImeta struct {
+	key    string
+	md     []Meta
+	policy FloatPolicy
+}
+
+func (o objectImeta) Key() []byte {
+	return toBytes(o.key)
+}
+
+func (o objectImeta) Value() []byte {
+	return o.AppendValue(nil)
+}
+
+func (o objectImeta) AppendValue(dst []byte) []byte {
+	return o.appendValue(dst, elementPolicy(o.policy))
+}
+
+func (o objectImeta) appendValue(dst []byte, p FloatPolicy) []byte {
+	enc := ObjectEncoder{buf: append(dst, '{'), policy: p}
+	enc.Add(o.md...)
+	return append(enc.buf, '}')
+}
+
+func (o objectImeta) Wrap() bool {
+	return false
+}
+
+func (o objectImeta) IsNil() bool {
+	return false
+}
+
+type arrayImeta struct {
+	key    string
+	md     []Meta
+	policy FloatPolicy
+}
+
+func (a arrayImeta) Key() []byte {
+	return toBytes(a.key)
+}
+
+func (a arrayImeta) Value() []byte {
+	return a.AppendValue(nil)
+}
+
+func (a arrayImeta) AppendValue(dst []byte) []byte {
+	return a.appendValue(dst, elementPolicy(a.policy))
+}
+
+func (a arrayImeta) appendValue(dst []byte, p FloatPolicy) []byte {
+	enc := ArrayEncoder{buf: append(dst, '['), policy: p}
+	enc.Append(a.md...)
+	return append(enc.buf, ']')
+}
+
+func (a arrayImeta) Wrap() bool {
+	return false
+}
+
+func (a arrayImeta) IsNil() bool {
+	return false
+}
+
+type objectMarshalerImeta struct {
+	key    string
+	v      ObjectMarshaler
+	policy FloatPolicy
+}
+
+func (o objectMarshalerImeta) Key() []byte {
+	return toBytes(o.key)
+}
+
+func (o objectMarshalerImeta) Value() []byte {
+	return o.AppendValue(nil)
+}
+
+func (o objectMarshalerImeta) AppendValue(dst []byte) []byte {
+	enc := ObjectEncoder{buf: append(dst, '{'), policy: elementPolicy(o.policy)}
+	o.v.MarshalLogObject(&enc)
+	return append(enc.buf, '}')
+}
+
+func (o objectMarshalerImeta) Wrap() bool {
+	return false
+}
+
+func (o objectMarshalerImeta) IsNil() bool {
+	return false
+}
+
+type arrayMarshalerImeta struct {
+	key    string
+	v      ArrayMarshaler
+	policy FloatPolicy
+}
+
+func (a arrayMarshalerImeta) Key() []byte {
+	return toBytes(a.key)
+}
+
+func (a arrayMarshalerImeta) Value() []byte {
+	return a.AppendValue(nil)
+}
+
+func (a arrayMarshalerImeta) AppendValue(dst []byte) []byte {
+	enc := ArrayEncoder{buf: append(dst, '['), policy: elementPolicy(a.policy)}
+	a.v.MarshalLogArray(&enc)
+	return append(enc.buf, ']')
+}
+
+func (a arrayMarshalerImeta) Wrap() bool {
+	return false
+}
+
+func (a arrayMarshalerImeta) IsNil() bool {
+	return false
+}
+
+// Object ... a nested object of the fields md, e.g.
+//
+//	encode.Object("http", encode.String("method", "GET"), encode.Int("status", 200))
+//
+// is encoded as "http":{"method":"GET","status":200}.
+func Object(key string, md ...Meta) Meta {
+	o := objectImeta{key: key, md: md}
+	if n, ok := firstNonFinite(md); ok {
+		return valueMeta(nonFiniteImeta{key: key, first: n.first, appendValue: func(dst []byte, p FloatPolicy) []byte {
+			return o.appendValue(dst, elementPolicy(p))
+		}})
+	}
+	return valueMeta(o)
+}
+
+// Array ... an array of the values of md, their keys are ignored, e.g.
+//
+//	encode.Array("users", encode.Object("", encode.String("name", "Tom")), encode.Object("", encode.String("name", "Jeiry")))
+//
+// is encoded as "users":[{"name":"Tom"},{"name":"Jeiry"}].
+func Array(key string, md ...Meta) Meta {
+	a := arrayImeta{key: key, md: md}
+	if n, ok := firstNonFinite(md); ok {
+		return valueMeta(nonFiniteImeta{key: key, first: n.first, appendValue: func(dst []byte, p FloatPolicy) []byte {
+			return a.appendValue(dst, elementPolicy(p))
+		}})
+	}
+	return valueMeta(a)
+}
+
+// MarshalObject ... the object v encodes by itself, null if v is nil.
+func MarshalObject(key string, v ObjectMarshaler) Meta {
+	if v == nil || isNilPointer(v) {
+		return valueMeta(nullImeta(key))
+	}
+	return valueMeta(objectMarshalerImeta{key: key, v: v})
+}
+
+// MarshalArray ... the array v encodes by itself, null if v is nil.
+func MarshalArray(key string, v ArrayMarshaler) Meta {
+	if v == nil || isNilPointer(v) {
+		return valueMeta(nullImeta(key))
+	}
+	return valueMeta(arrayMarshalerImeta{key: key, v: v})
+}
+
+// isNilPointer reports a nil pointer held by a non-nil interface,
+// whose methods would dereference it.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+// appendField appends md as a JSON field "key":value.
+func appendField(dst []byte, md Meta) []byte {
+	dst = append(dst, '"')
+	dst = AppendBytes(dst, md.Key(), false)
+	dst = append(dst, '"', ':')
+	return appendValue(dst, md)
+}
+
+// appendValue appends the JSON value of md.
+func appendValue(dst []byte, md Meta) []byte {
+	if md.Wrap() {
+		dst = append(dst, '"')
+		dst = AppendBytes(dst, md.Value(), false)
+		return append(dst, '"')
+	}
+	return md.AppendValue(dst)
+}
@@ -0,0 +1,81 @@
+package encode
+
+import (
+	"strconv"
+	"time"
+)
+
+// The layouts of TimeLayout for the unix timestamps.
+const (
+	// UnixLayout ... seconds.
+	UnixLayout = "unix"
+	// UnixMilliLayout ... milliseconds.
+	UnixMilliLayout = "unixmilli"
+	// UnixMicroLayout ... microseconds.
+	UnixMicroLayout = "unixmicro"
+	// UnixNanoLayout ... nanoseconds.
+	UnixNanoLayout = "unixnano"
+)
+
+// DefaultTimeLayout ... the layout of Time.
+const DefaultTimeLayout = time.RFC3339Nano
+
+// DurationFormat ... how Duration encodes a time.Duration.
+type DurationFormat int
+
+const (
+	// DurationString ... a string such as "1.5s".
+	DurationString DurationFormat = iota
+	// DurationNanos ... an integer number of nanoseconds.
+	DurationNanos
+	// DurationMillis ... an integer number of milliseconds.
+	DurationMillis
+	// DurationSeconds ... a float number of seconds.
+	DurationSeconds
+)
+
+// Time ... t formatted with DefaultTimeLayout.
+func Time(key string, t time.Time) Meta {
+	return TimeLayout(key, t, DefaultTimeLayout)
+}
+
+// TimeLayout ... t formatted with layout, or as an integer if layout is one of
+// UnixLayout, UnixMilliLayout, UnixMicroLayout and UnixNanoLayout.
+func TimeLayout(key string, t time.Time, layout string) Meta {
+	switch layout {
+	case UnixLayout:
+		return Int64(key, t.Unix())
+	case UnixMilliLayout:
+		return Int64(key, t.UnixNano()/int64(time.Millisecond))
+	case UnixMicroLayout:
+		return Int64(key, t.UnixNano()/int64(time.Microsecond))
+	case UnixNanoLayout:
+		return Int64(key, t.UnixNano())
+	}
+	return valueMeta(imeta{
+		key:   toBytes(key),
+		value: t.AppendFormat(make([]byte, 0, len(layout)+10), layout),
+		wrap:  true,
+	})
+}
+
+// Duration ... d as a string such as "1.5s".
+func Duration(key string, d time.Duration) Meta {
+	return DurationAs(key, d, DurationString)
+}
+
+// DurationAs ... d encoded per format.
+func DurationAs(key string, d time.Duration, format DurationFormat) Meta {
+	switch format {
+	case DurationNanos:
+		return Int64(key, int64(d))
+	case DurationMillis:
+		return Int64(key, int64(d/time.Millisecond))
+	case DurationSeconds:
+		return valueMeta(imeta{
+			key:   toBytes(key),
+			value: strconv.AppendFloat(make([]byte, 0, 8), d.Seconds(), 'f', -1, 64),
+		})
+	}
+	return String(key, d.String())
+}
@@ -0,0 +1,111 @@
+package simplelog
+
+import (
+	"github.com/tanzy2018/simplelog/encode"
+	"github.com/tanzy2018/simplelog/internal"
+)
+
+// Encoder ... encodes a record field by field by appending to dst.
+// For each record the calls are Begin, AppendTime (if the time field is enabled),
+// AppendLevel, AppendMsg, AppendEncoded (fields bound by With), AppendMeta (hooks and custom meta),
+// AppendStack (if any) and End.
+// An Encoder is shared by all the goroutines writing to a Log, called concurrently,
+// and must not keep any state per record.
+type Encoder interface {
+	// Begin ... starts a record.
+	Begin(dst []byte) []byte
+	// AppendTime ... md holds the time already formatted per the time format of the Log.
+	AppendTime(dst []byte, md encode.Meta) []byte
+	// AppendLevel ...
+	AppendLevel(dst []byte, key string, level LevelType) []byte
+	// AppendMsg ...
+	AppendMsg(dst []byte, key, msg string) []byte
+	// AppendMeta ... appends a field, dst may also be empty to encode fields ahead of time.
+	AppendMeta(dst []byte, md encode.Meta) []byte
+	// AppendEncoded ... appends fields encoded ahead of time by AppendMeta.
+	AppendEncoded(dst, fields []byte) []byte
+	// AppendStack ...
+	AppendStack(dst []byte, md encode.Meta) []byte
+	// End ... finishes the record, including the line ending.
+	End(dst []byte) []byte
+}
+
+// JSONEncoder ... the default Encoder, one JSON object per line.
+type JSONEncoder struct {
+	// EscapeHTML ... escape '<', '>' and '&' in keys and string values, including the ones of arrays and objects.
+	EscapeHTML bool
+}
+
+// Begin ...
+func (enc *JSONEncoder) Begin(dst []byte) []byte {
+	return append(dst, leftDelimiter)
+}
+
+// AppendTime ...
+func (enc *JSONEncoder) AppendTime(dst []byte, md encode.Meta) []byte {
+	return enc.AppendMeta(dst, md)
+}
+
+// AppendLevel ...
+func (enc *JSONEncoder) AppendLevel(dst []byte, key string, level LevelType) []byte {
+	dst = enc.appendKey(dst, internal.ToBytes(key))
+	dst = append(dst, valueWrapper)
+	dst = append(dst, level.String()...)
+	return append(dst, valueWrapper)
+}
+
+// AppendMsg ...
+func (enc *JSONEncoder) AppendMsg(dst []byte, key, msg string) []byte {
+	dst = enc.appendKey(dst, internal.ToBytes(key))
+	dst = append(dst, valueWrapper)
+	dst = encode.AppendString(dst, msg, enc.EscapeHTML)
+	return append(dst, valueWrapper)
+}
+
+// AppendMeta ...
+func (enc *JSONEncoder) AppendMeta(dst []byte, md encode.Meta) []byte {
+	dst = enc.appendKey(dst, md.Key())
+	if md.Wrap() {
+		dst = append(dst, valueWrapper)
+		dst = encode.AppendBytes(dst, md.Value(), enc.EscapeHTML)
+		return append(dst, valueWrapper)
+	}
+	if !enc.EscapeHTML {
+		return md.AppendValue(dst)
+	}
+	// the strings of the arrays and objects are escaped by the values themselves, without escapeHTML.
+	start := len(dst)
+	return encode.HTMLEscape(md.AppendValue(dst), start)
+}
+
+// AppendEncoded ...
+func (enc *JSONEncoder) AppendEncoded(dst, fields []byte) []byte {
+	if len(fields) == 0 {
+		return dst
+	}
+	return append(enc.appendFieldDelimiter(dst), fields...)
+}
+
+// AppendStack ...
+func (enc *JSONEncoder) AppendStack(dst []byte, md encode.Meta) []byte {
+	return enc.AppendMeta(dst, md)
+}
+
+// End ...
+func (enc *JSONEncoder) End(dst []byte) []byte {
+	return append(dst, rightDelimiter, endDelimiter)
+}
+
+func (enc *JSONEncoder) appendKey(dst, key []byte) []byte {
+	dst = enc.appendFieldDelimiter(dst)
+	dst = append(dst, valueWrapper)
+	dst = encode.AppendBytes(dst, key, enc.EscapeHTML)
+	return append(dst, valueWrapper, kvDelimiter)
+}
+
+func (enc *JSONEncoder) appendFieldDelimiter(dst []byte) []byte {
+	if len(dst) == 0 || dst[len(dst)-1] == leftDelimiter {
+		return dst
+	}
+	return append(dst, fieldDelimiter)
+}
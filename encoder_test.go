@@ -0,0 +1,96 @@
+package simplelog
+
+import (
+	"math"
+	"regexp"
+	"testing"
+
+	"github.com/tanzy2018/simplelog/encode"
+)
+
+func TestConsoleEncoder(t *testing.T) {
+	w := &testWriter{}
+	newLog := New(WithEncoder(&ConsoleEncoder{})).WithWriterCloser(w, false, true)
+	newLog.With(encode.String("request_id", "r1")).
+		Info("profile", encode.String("name", "Tom"), encode.Int("id", 10), encode.String("note", "a b"))
+	newLog.Warn("warnmsg", encode.Ints("ids", []int{1}))
+	newLog.Error("line1\nline2 \"forged\"")
+
+	want := regexp.MustCompile(`^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d INFO  profile request_id=r1 name=Tom id=10 note="a b"
+\d{4}-\d\d-\d\d \d\d:\d\d:\d\d WARN  warnmsg ids=\[1\]
+\d{4}-\d\d-\d\d \d\d:\d\d:\d\d ERROR "line1\\nline2 \\"forged\\""
+$`)
+	if !want.Match(w.Bytes()) {
+		t.Errorf("unexpected output:\n%s", w.Bytes())
+	}
+}
+
+func TestConsoleEncoderColor(t *testing.T) {
+	enc := &ConsoleEncoder{Color: true}
+	got := string(enc.AppendLevel(nil, LevelFieldName, ERROR))
+	if want := "\x1b[31mERROR\x1b[0m"; got != want {
+		t.Errorf("Actual = %q, want %q", got, want)
+	}
+	if NewConsoleEncoder(&testWriter{}).Color {
+		t.Errorf("color should be disabled for a non terminal writer")
+	}
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	type user struct {
+		Name string
+		Tags []string
+	}
+	w := &testWriter{}
+	newLog := New(WithEncoder(NewLogfmtEncoder()), WithTimeField("", "")).WithWriterCloser(w, false, true)
+	newLog.Hook(func() encode.Meta {
+		return encode.String("service", "demo")
+	})
+	newLog.With(encode.Int("id", 10)).Info("user profile",
+		encode.String("name", "Tom"),
+		encode.String("quote", `say "hi"=`),
+		encode.Ints("ids", []int{1, -2}),
+		encode.Strings("empty", nil),
+		encode.Any("user", user{"Tom", []string{"admin", "a b"}}),
+		encode.Any("map", map[string]interface{}{"b": 1.5, "a": nil, "c": map[string]int{}}),
+		encode.Bool("ok", true),
+		encode.String("bad key", ""),
+	)
+
+	want := `level=info msg="user profile" id=10 service=demo name=Tom quote="say \"hi\"=" ids.0=1 ids.1=-2 empty=[] ` +
+		`user.Name=Tom user.Tags.0=admin user.Tags.1="a b" map.a=null map.b=1.5 map.c={} ok=true bad_key=""` + "\n"
+	if got := w.String(); got != want {
+		t.Errorf("\nActual = %s\nwant   = %s", got, want)
+	}
+}
+
+func TestJSONEncoderObject(t *testing.T) {
+	w := &testWriter{}
+	newLog := New(WithTimeField("", "")).WithWriterCloser(w, false, true)
+	newLog.Info("request", encode.Object("http", encode.String("method", "GET"), encode.Int("status", 200)))
+
+	want := `{"level":"info","msg":"request","http":{"method":"GET","status":200}}` + "\n"
+	if got := w.String(); got != want {
+		t.Errorf("\nActual = %s\nwant   = %s", got, want)
+	}
+}
+
+func TestFloatPolicy(t *testing.T) {
+	tests := []struct {
+		policy encode.FloatPolicy
+		want   string
+	}{
+		{encode.FloatAsString, `{"level":"info","msg":"floats","f":"NaN","fs":[1,"+Inf"]}`},
+		{encode.FloatAsNull, `{"level":"info","msg":"floats","f":null,"fs":[1,null]}`},
+		{encode.FloatAsError, `{"level":"info","msg":"floats","f":null,"fError":"unsupported float value NaN","fs":[1,null],"fsError":"unsupported float value +Inf"}`},
+	}
+	for _, tt := range tests {
+		w := &testWriter{}
+		newLog := New(WithTimeField("", ""), WithFloatPolicy(tt.policy)).WithWriterCloser(w, false, true)
+		newLog.Info("floats", encode.Float64("f", math.NaN()), encode.Float32s("fs", []float32{1, float32(math.Inf(1))}))
+		if got := w.String(); got != tt.want+"\n" {
+			t.Errorf("\nActual = %s\nwant   = %s", got, tt.want)
+		}
+		w.records(t)
+	}
+}
@@ -0,0 +1,64 @@
+package simplelog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// fatalHooks ... the hooks of OnFatal, shared by a Log and its children.
+type fatalHooks struct {
+	lo    sync.Mutex
+	hooks []func()
+}
+
+func (fh *fatalHooks) add(f func()) {
+	fh.lo.Lock()
+	defer fh.lo.Unlock()
+	fh.hooks = append(fh.hooks, f)
+}
+
+func (fh *fatalHooks) all() []func() {
+	fh.lo.Lock()
+	defer fh.lo.Unlock()
+	return append([]func(){}, fh.hooks...)
+}
+
+// OnFatal ... registers f to run before Log.Fatal exits, in the order of registration.
+// All the hooks together are given the timeout of WithFatalHookTimeout.
+func (l *Log) OnFatal(f func()) {
+	if f != nil {
+		l.fatalHooks.add(f)
+	}
+}
+
+// runFatalHooks runs the hooks in order, giving up on them after the timeout.
+func (l *Log) runFatalHooks() {
+	hooks := l.fatalHooks.all()
+	if len(hooks) == 0 {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, f := range hooks {
+			l.runFatalHook(f)
+		}
+	}()
+	timer := time.NewTimer(l.op.fatalTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		l.errHandle(fmt.Errorf("simplelog: fatal hooks timed out after %v", l.op.fatalTimeout))
+	}
+}
+
+func (l *Log) runFatalHook(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.errHandle(fmt.Errorf("simplelog: fatal hook panicked: %v", r))
+		}
+	}()
+	f()
+}
@@ -1,36 +1,60 @@
 package simplelog
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/tanzy2018/simplelog/encode"
 )
 
 // HookFunc ...
 type HookFunc func() encode.Meta
 
-// IHook ...
+// IHook ... Add may be called while other goroutines call Hooks, so an IHook
+// must be safe for concurrent use.
 type IHook interface {
 	Add(hfs ...HookFunc)
 	Hooks() []encode.Meta
 }
 
+// hook ... the HookFuncs are copied on Add, so that Hooks reads them without a lock.
 type hook struct {
-	hfs []HookFunc
+	lo sync.Mutex
+	// hfs holds a []HookFunc, never modified once stored.
+	hfs atomic.Value
 }
 
 func (h *hook) Add(hfs ...HookFunc) {
-	if len(h.hfs) == 0 {
-		h.hfs = make([]HookFunc, 0, 1)
-	}
+	h.lo.Lock()
+	defer h.lo.Unlock()
+	old := h.funcs()
+	funcs := make([]HookFunc, 0, len(old)+len(hfs))
+	funcs = append(funcs, old...)
+	h.hfs.Store(append(funcs, hfs...))
+}
 
-	h.hfs = append(h.hfs, hfs...)
+func (h *hook) funcs() []HookFunc {
+	hfs, _ := h.hfs.Load().([]HookFunc)
+	return hfs
 }
 
 func (h *hook) Hooks() []encode.Meta {
 	if h == nil {
 		return nil
 	}
-	md := make([]encode.Meta, 0, len(h.hfs))
-	for _, hf := range h.hfs {
+	hfs := h.funcs()
+	if len(hfs) == 0 {
+		return nil
+	}
+	return h.appendHooks(make([]encode.Meta, 0, len(hfs)))
+}
+
+// appendHooks appends the Meta of the hooks to md, sparing the allocation of Hooks.
+func (h *hook) appendHooks(md []encode.Meta) []encode.Meta {
+	if h == nil {
+		return md
+	}
+	for _, hf := range h.funcs() {
 		md = append(md, hf())
 	}
 	return md
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// Frames ... returns at most depth frames of the stack of the caller of Frames,
+// skipping skip frames first and then every frame for which drop returns true.
+func Frames(skip, depth int, drop func(*runtime.Frame) bool) []runtime.Frame {
+	if depth <= 0 {
+		return nil
+	}
+	// leave room for the frames to drop.
+	pcs := make([]uintptr, depth+32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := make([]runtime.Frame, 0, depth)
+	it := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := it.Next()
+		if frame.PC != 0 && (drop == nil || !drop(&frame)) {
+			frames = append(frames, frame)
+			if len(frames) == depth {
+				return frames
+			}
+		}
+		if !more {
+			return frames
+		}
+	}
+}
+
+// CallStack ... joins frames as file:line.(function)->file:line.(function)...
+func CallStack(frames []runtime.Frame) string {
+	callers := make([]byte, 0, 1024)
+	for i, f := range frames {
+		if i > 0 {
+			callers = append(callers, "->"...)
+		}
+		callers = append(callers, f.File...)
+		callers = append(callers, ':')
+		callers = strconv.AppendInt(callers, int64(f.Line), 10)
+		callers = append(callers, '.', '(')
+		callers = append(callers, f.Function...)
+		callers = append(callers, ')')
+	}
+	return ToString(callers)
+}
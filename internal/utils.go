@@ -2,9 +2,6 @@ package internal
 
 import (
 	"math/rand"
-	"runtime"
-	"strconv"
-	"strings"
 	"time"
 	"unsafe"
 )
@@ -38,7 +35,11 @@ func ToBytes(s string) []byte {
 	if len(s) == 0 {
 		return nil
 	}
-	return *(*[]byte)(unsafe.Pointer(&s))
+	// the cap is set to the length, reading past the string header would leave it undefined.
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		string
+		Cap int
+	}{s, len(s)}))
 }
 
 // RandInt ...
@@ -85,44 +86,3 @@ func randomString(n int, seed string) []byte {
 
 	return tpl[:n]
 }
-
-// CallStack ...
-func CallStack(skip int) string {
-	if skip < 1 {
-		skip = 1
-	}
-	firstFrame, depth := skip, 20+skip
-	var (
-		pc   uintptr
-		file string
-		line int
-		ok   bool
-	)
-	callers := make([]byte, 0, 1024)
-	for {
-		pc, file, line, ok = runtime.Caller(skip)
-		if !ok {
-			return ToString(callers[:])
-		}
-		if strings.Contains(file, "/src/runtime/") {
-			skip++
-			firstFrame++
-			continue
-		}
-		f := runtime.FuncForPC(pc)
-		if skip > firstFrame {
-			callers = append(callers, []byte("->")...)
-		}
-		callers = append(callers, ToBytes(file)...)
-		callers = append(callers, ':')
-		callers = append(callers, ToBytes(strconv.FormatInt(int64(line), 10))...)
-		callers = append(callers, '.')
-		callers = append(callers, '(')
-		callers = append(callers, ToBytes(f.Name())...)
-		callers = append(callers, ')')
-		skip++
-		if skip > depth {
-			return ToString(callers[:])
-		}
-	}
-}
@@ -44,6 +44,9 @@ func TestToBytes(t *testing.T) {
 		if string(td.expected) != string(actual) {
 			t.Errorf("\nname:%s,\nexpected:%s,\nactual:%s\n", td.name, td.expected, actual)
 		}
+		if cap(actual) != len(td.data) {
+			t.Errorf("\nname:%s,\nexpected cap:%d,\nactual cap:%d\n", td.name, len(td.data), cap(actual))
+		}
 	}
 }
 
@@ -1,5 +1,12 @@
 package simplelog
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // LevelType ...
 type LevelType int32
 
@@ -44,7 +51,7 @@ var levelNames = [...]string{
 	DebugLevelName,
 	InfoLevelName,
 	WarnLevelName,
-	ErrFieldName,
+	ErrorLevelName,
 	PanicLevelName,
 	FatalLevelName,
 	NoLevelName,
@@ -63,3 +70,88 @@ func (level LevelType) isValid() bool {
 	}
 	return true
 }
+
+// ParseLevel ... parses a level name case-insensitively, e.g. "info" or "INFO".
+// The aliases "warning" and "err" are accepted, and "off" or "none" mean NOLEVEL.
+// An empty name is an error, so that an unset env var does not turn off logging.
+func ParseLevel(name string) (LevelType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case DebugLevelName:
+		return DEBUG, nil
+	case InfoLevelName:
+		return INFO, nil
+	case WarnLevelName, "warning":
+		return WARN, nil
+	case ErrorLevelName, "err":
+		return ERROR, nil
+	case PanicLevelName:
+		return PANIC, nil
+	case FatalLevelName:
+		return FATAL, nil
+	case "off", "none":
+		return NOLEVEL, nil
+	case "":
+		return 0, errors.New("simplelog: empty level")
+	}
+	return 0, fmt.Errorf("simplelog: unknown level %q", name)
+}
+
+// MarshalText ... implements encoding.TextMarshaler, NOLEVEL being "off".
+func (level LevelType) MarshalText() ([]byte, error) {
+	if !level.isValid() {
+		return nil, fmt.Errorf("simplelog: invalid level %d", int32(level))
+	}
+	if level == NOLEVEL {
+		return []byte("off"), nil
+	}
+	return []byte(level.String()), nil
+}
+
+// UnmarshalText ... implements encoding.TextUnmarshaler, so that levels can be read from env vars and config files.
+func (level *LevelType) UnmarshalText(text []byte) error {
+	lvl, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*level = lvl
+	return nil
+}
+
+// MarshalJSON ... implements json.Marshaler.
+func (level LevelType) MarshalJSON() ([]byte, error) {
+	text, err := level.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON ... implements json.Unmarshaler, accepting a level name or its number.
+func (level *LevelType) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		return level.UnmarshalText([]byte(name))
+	}
+	var lvl int32
+	if err := json.Unmarshal(b, &lvl); err != nil {
+		return fmt.Errorf("simplelog: invalid level %s", b)
+	}
+	if !LevelType(lvl).isValid() {
+		return fmt.Errorf("simplelog: invalid level %d", lvl)
+	}
+	*level = LevelType(lvl)
+	return nil
+}
+
+// Set ... implements flag.Value:
+//
+//	var level = simplelog.INFO
+//	flag.Var(&level, "level", "log level")
+func (level *LevelType) Set(name string) error {
+	return level.UnmarshalText([]byte(name))
+}
+
+// Get ... implements flag.Getter.
+func (level *LevelType) Get() interface{} {
+	return *level
+}
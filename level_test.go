@@ -0,0 +1,166 @@
+package simplelog
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    LevelType
+		wantErr bool
+	}{
+		{"debug", DEBUG, false},
+		{"INFO", INFO, false},
+		{" Warn ", WARN, false},
+		{"error", ERROR, false},
+		{"panic", PANIC, false},
+		{"fatal", FATAL, false},
+		{"Warning", WARN, false},
+		{"ERR", ERROR, false},
+		{"off", NOLEVEL, false},
+		{"none", NOLEVEL, false},
+		{"", 0, true},
+		{"  ", 0, true},
+		{"verbose", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Actual = %v,%v, want %v,%v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLevelString(t *testing.T) {
+	if got := ERROR.String(); got != ErrorLevelName {
+		t.Errorf("Actual = %s, want %s", got, ErrorLevelName)
+	}
+}
+
+func TestLevelMarshal(t *testing.T) {
+	type config struct {
+		Level LevelType `json:"level"`
+	}
+	for level := DEBUG; level <= NOLEVEL; level++ {
+		b, err := json.Marshal(config{level})
+		if err != nil {
+			t.Fatalf("%v: %v", level, err)
+		}
+		var c config
+		if err := json.Unmarshal(b, &c); err != nil || c.Level != level {
+			t.Errorf("round trip of %s: actual %v,%v", b, c.Level, err)
+		}
+	}
+
+	var c config
+	if err := json.Unmarshal([]byte(`{"level":3}`), &c); err != nil || c.Level != WARN {
+		t.Errorf("numeric level: actual %v,%v", c.Level, err)
+	}
+	if err := json.Unmarshal([]byte(`{"level":"verbose"}`), &c); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+	if err := c.Level.UnmarshalText(nil); err == nil {
+		t.Errorf("expected an error for an empty level")
+	}
+	if _, err := json.Marshal(config{LevelType(100)}); err == nil {
+		t.Errorf("expected an error for an invalid level")
+	}
+}
+
+func TestLevelFlag(t *testing.T) {
+	level := INFO
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(&level, "level", "log level")
+	if err := fs.Parse([]string{"-level", "warning"}); err != nil || level != WARN {
+		t.Errorf("Actual = %v,%v, want %v", level, err, WARN)
+	}
+	if err := fs.Parse([]string{"-level", "verbose"}); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+	if err := fs.Parse([]string{"-level", ""}); err == nil || level != WARN {
+		t.Errorf("expected an error for an empty level, actual %v,%v", level, err)
+	}
+}
+
+func TestAtomicLevel(t *testing.T) {
+	w := &testWriter{}
+	newLog := New(WithLevel(INFO)).WithWriterCloser(w, false, true)
+
+	newLog.Debug("dropped")
+	newLog.SetLevel(DEBUG)
+	newLog.Debug("written")
+	newLog.SetLevel(LevelType(100))
+	if newLog.AtomicLevel().Level() != DEBUG {
+		t.Errorf("invalid level should be ignored, actual %v", newLog.AtomicLevel().Level())
+	}
+
+	records := w.records(t)
+	if len(records) != 1 || records[0]["msg"] != "written" {
+		t.Errorf("unexpected records: %v", records)
+	}
+}
+
+func TestAtomicLevelSetLevelFor(t *testing.T) {
+	al := NewAtomicLevel(INFO)
+	al.SetLevelFor(DEBUG, 50*time.Millisecond)
+	al.SetLevelFor(DEBUG, 50*time.Millisecond)
+	if al.Level() != DEBUG {
+		t.Fatalf("expected DEBUG, actual %v", al.Level())
+	}
+	time.Sleep(200 * time.Millisecond)
+	if al.Level() != INFO {
+		t.Fatalf("expected revert to INFO, actual %v", al.Level())
+	}
+
+	al.SetLevelFor(DEBUG, 50*time.Millisecond)
+	al.SetLevel(WARN)
+	time.Sleep(200 * time.Millisecond)
+	if al.Level() != WARN {
+		t.Fatalf("SetLevel should cancel the revert, actual %v", al.Level())
+	}
+}
+
+func TestAtomicLevelServeHTTP(t *testing.T) {
+	al := NewAtomicLevel(INFO)
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, `{"level":"info"}`},
+		{"put_off", http.MethodPut, `{"level":"off"}`, http.StatusOK, `{"level":"off"}`},
+		{"get_off", http.MethodGet, "", http.StatusOK, `{"level":"off"}`},
+		{"put", http.MethodPut, `{"level":"WARN"}`, http.StatusOK, `{"level":"warn"}`},
+		{"put_empty", http.MethodPut, `{}`, http.StatusBadRequest, `{"error":"level is required"}`},
+		{"put_unknown", http.MethodPut, `{"level":"verbose"}`, http.StatusBadRequest, `{"error":"simplelog: unknown level \"verbose\""}`},
+		{"put_bad_duration", http.MethodPut, `{"level":"debug","duration":"soon"}`, http.StatusBadRequest, ""},
+		{"put_bad_body", http.MethodPut, `level=debug`, http.StatusBadRequest, ""},
+		{"post", http.MethodPost, "", http.StatusMethodNotAllowed, ""},
+		{"get_after", http.MethodGet, "", http.StatusOK, `{"level":"warn"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			al.ServeHTTP(rec, httptest.NewRequest(tt.method, "/log/level", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Errorf("code: actual %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); len(tt.wantBody) > 0 && got != tt.wantBody {
+				t.Errorf("body: actual %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
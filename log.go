@@ -1,9 +1,12 @@
 package simplelog
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tanzy2018/simplelog/encode"
@@ -26,39 +29,80 @@ type Logger interface {
 	Fatal(msg string, md ...encode.Meta)
 }
 
-// Log ...
+// Log ... a Log and the children derived from it by With are safe for concurrent use.
+// The options are fixed by New, and the methods changing a Log at runtime,
+// SetLevel, Hook, OnFatal, WithWriterCloser, WithFileWriter, Reopen, Flush and Close,
+// may be called while other goroutines are logging.
+// The ErrorHandler, the HookFuncs and the Encoders may be called concurrently,
+// by the goroutines logging and by the background ones.
 type Log struct {
-	op          *options
-	wc          io.WriteCloser
-	curFileSize int64
-	autoReName  bool
-	syncBuf     *syncBuffer
-	recordBuf   *recordBuffer
-	lo          *sync.Mutex
-	nopClose    bool
+	*core
+	// fields are the fields bound by With, emitted after msg,
+	// encoded ahead of time by each of the distinct encoders of the core.
+	fields [][]byte
 }
 
-// New ...
+// core is the state shared by a Log and all the children derived from it by With.
+type core struct {
+	op *options
+	// main is the sink of WithWriterCloser and WithFileWriter, the first of sinks.
+	main       *Sink
+	sinks      []*Sink
+	encoders   []Encoder
+	fatalHooks *fatalHooks
+	// async is the queue of WithAsync, nil for writing in the caller.
+	async *asyncQueue
+	// closed is set once by Close, and read atomically to skip the records after it.
+	closed int32
+	// stop stops the background goroutines, tracked by wg.
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// ErrClosed ... returned by Flush and Close once the Log is closed.
+var ErrClosed = errors.New("simplelog: log is closed")
+
+// New ... each Log owns a copy of the default options, so loggers never affect each other.
 func New(ops ...Option) *Log {
 	l := &Log{
-		op: defaultOption,
+		core: &core{
+			op:         _defaultOPtion(),
+			fatalHooks: new(fatalHooks),
+			stop:       make(chan struct{}),
+		},
 	}
 	for _, f := range ops {
 		f(l.op)
 	}
-	l.syncBuf = newSyncBuffers(l, l.op.maxSyncBufSize)
-	l.recordBuf = newRecordBuffers(l, l.op.maxRecordSize)
-	l.lo = new(sync.Mutex)
-	l.wc = os.Stdout
-	l.nopClose = true
+	if l.op.encoder == nil {
+		l.op.encoder = &JSONEncoder{EscapeHTML: l.op.escapeHTML}
+	}
+	l.op.cacheTime = isSecondLayout(l.op.timeFieldFormat)
+	if l.op.asyncSize > 0 {
+		l.async = newAsyncQueue(l.op.asyncSize, l.op.overflow)
+	}
+	l.main = &Sink{op: l.op, wc: os.Stdout, nopClose: true}
+	for _, s := range append([]*Sink{l.main}, l.op.sinks...) {
+		if err := s.attach(l.core); err != nil {
+			l.errHandle(err)
+			continue
+		}
+		l.sinks = append(l.sinks, s)
+	}
+	l.fields = make([][]byte, len(l.encoders))
 	l.backendSync()
+	l.backendAsync()
+	for _, s := range l.sinks {
+		s.backendRotate()
+	}
+	l.backendReopen()
 	return l
 }
 
 // Debug ...
 func (l *Log) Debug(msg string, md ...encode.Meta) {
 	// 少一次函数调用
-	if l.op.level > int32(DEBUG) {
+	if l.op.level.Level() > DEBUG {
 		return
 	}
 	l.write(DEBUG, msg, md...)
@@ -67,7 +111,7 @@ func (l *Log) Debug(msg string, md ...encode.Meta) {
 // Info ...
 func (l *Log) Info(msg string, md ...encode.Meta) {
 	// reduce another function call
-	if l.op.level > int32(INFO) {
+	if l.op.level.Level() > INFO {
 		return
 	}
 	l.write(INFO, msg, md...)
@@ -76,7 +120,7 @@ func (l *Log) Info(msg string, md ...encode.Meta) {
 // Warn ...
 func (l *Log) Warn(msg string, md ...encode.Meta) {
 	// reduce another function call
-	if l.op.level > int32(WARN) {
+	if l.op.level.Level() > WARN {
 		return
 	}
 	l.write(WARN, msg, md...)
@@ -85,188 +129,255 @@ func (l *Log) Warn(msg string, md ...encode.Meta) {
 // Error ...
 func (l *Log) Error(msg string, md ...encode.Meta) {
 	// reduce another function call
-	if l.op.level > int32(ERROR) {
+	if l.op.level.Level() > ERROR {
 		return
 	}
 	l.write(ERROR, msg, md...)
 }
 
-// Panic ...
+// Panic ... writes and flushes the record, then calls the PanicHook of WithPanicBehavior,
+// DefaultPanicHook by default. The hook is called even if PANIC is disabled by the level.
 func (l *Log) Panic(msg string, md ...encode.Meta) {
-	// reduce another function call
-	if l.op.level > int32(PANIC) {
-		return
+	if l.op.level.Level() <= PANIC {
+		l.write(PANIC, msg, md...)
+		l.errHandle(l.Flush())
 	}
-	l.write(PANIC, msg, md...)
+	l.op.panicHook(msg, md)
 }
 
-// Fatal ...
+// Fatal ... writes and flushes the record, runs the hooks of OnFatal and then
+// calls the exit function of WithExitFunc with the code of WithExitCode.
+// It exits even if FATAL is disabled by the level.
 func (l *Log) Fatal(msg string, md ...encode.Meta) {
-	// reduce another function call
-	if l.op.level > int32(FATAL) {
-		return
+	if l.op.level.Level() <= FATAL {
+		l.write(FATAL, msg, md...)
 	}
-	l.write(FATAL, msg, md...)
-	l.lock()
-	l.sync()
-	l.close()
-	l.unlock()
-	os.Exit(-1)
+	l.errHandle(l.Flush())
+	// the hooks may still log.
+	l.runFatalHooks()
+	l.errHandle(l.Close())
+	l.op.exitFunc(l.op.exitCode)
 }
 
-// Hook ...
-func (l *Log) Hook(hfs ...HookFunc) {
-	if l.op.hook == nil {
-		l.op.hook = new(hook)
-	}
-	l.op.hook.Add(hfs...)
+// SetLevel ... change the level at runtime, safe for concurrent use.
+func (l *Log) SetLevel(level LevelType) {
+	l.op.level.SetLevel(level)
 }
 
-// Sync ...
-func (l *Log) Sync() {
-	l.lock()
-	defer l.unlock()
-	l.sync()
-	l.close()
+// AtomicLevel ... the level of l, which can also be served over HTTP:
+//
+//	http.Handle("/log/level", l.AtomicLevel())
+func (l *Log) AtomicLevel() *AtomicLevel {
+	return l.op.level
 }
 
-// WithWriterCloser ...
-func (l *Log) WithWriterCloser(wc io.WriteCloser, needAutoRename, nopClose bool) *Log {
-	l.lock()
-	defer l.unlock()
-	l.sync()
-	l.close()
-	l.wc = wc
-	l.autoReName = needAutoRename
-	l.nopClose = true
-	return l
+// With returns a child Log carrying md as bound fields.
+// The child shares the writer, buffers and lock of l, and md is encoded only once,
+// so it is cheap to derive a child per request.
+func (l *Log) With(md ...encode.Meta) *Log {
+	if len(md) == 0 {
+		return l
+	}
+	fields := make([][]byte, len(l.encoders))
+	for i, enc := range l.encoders {
+		fields[i] = make([]byte, 0, len(l.fields[i])+64)
+		fields[i] = append(fields[i], l.fields[i]...)
+		fields[i] = enc.AppendEncoded(fields[i], l.op.encodeFields(enc, md))
+	}
+	return &Log{
+		core:   l.core,
+		fields: fields,
+	}
 }
 
-// WithFileWriter ...
-func (l *Log) WithFileWriter(root, topic, fname string) *Log {
-	l.lock()
-	defer l.unlock()
-	l.sync()
-	l.errHandle(l.close())
-	l.updateFileOption(root, topic, fname)
-	l.errHandle(l.makedir())
-	l.errHandle(l.newWriterCloserFromFile())
-	return l
+// Hook ... adds hooks evaluated for each record, safe to call while logging.
+func (l *Log) Hook(hfs ...HookFunc) {
+	l.op.hook.Add(hfs...)
 }
 
-func (l *Log) updateFileOption(root, topic, fname string) {
-	l.op.updateFileOption(root, topic, fname)
+// Sync ... the same as Flush.
+func (l *Log) Sync() error {
+	return l.Flush()
 }
 
-func (l *Log) errHandle(errs ...error) {
-	if errHandle := l.op.errHandler; errHandle != nil {
-		for _, err := range errs {
-			if err != nil {
-				errHandle(err)
-			}
+// Flush ... writes the buffered records to the writers, returning the first error.
+// With WithAsync, it waits for the records queued before it to be written.
+func (l *Log) Flush() error {
+	if l.async != nil {
+		done := make(chan error, 1)
+		select {
+		case l.async.flushc <- done:
+			return <-done
+		case <-l.stop:
+			return ErrClosed
+		}
+	}
+	var err error
+	for _, s := range l.sinks {
+		if serr := s.flush(); err == nil {
+			err = serr
 		}
 	}
+	return err
 }
 
-func (l *Log) sync() {
-	b := l.syncBuf.flushAsBytes()
-	if len(b) == 0 {
-		return
+// Close ... stops the background flush, flushes the buffered records and closes the writer,
+// unless it was set with nopClose. The records written after Close are dropped.
+// Close closes the children derived by With as well, since they share the writer.
+func (l *Log) Close() error {
+	if !atomic.CompareAndSwapInt32(&l.closed, 0, 1) {
+		return ErrClosed
+	}
+	close(l.stop)
+	if l.async != nil {
+		<-l.async.done
 	}
-	l.curFileSize += int64(len(b))
-	_, _ = l.wc.Write(b)
-	l.orChangeFileWriter()
+	var err error
+	for _, s := range l.sinks {
+		if serr := s.shutdown(); err == nil {
+			err = serr
+		}
+	}
+	l.wg.Wait()
+	return err
 }
 
-func (l *Log) orChangeFileWriter() {
-	if !l.autoReName {
-		return
+// Shutdown ... Close, but gives up waiting once ctx is done and returns ctx.Err().
+func (l *Log) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	if l.curFileSize < l.op.maxFileSize {
-		return
+}
+
+func (c *core) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+// encoderIndex returns the index of enc in the distinct encoders, adding it if new.
+func (c *core) encoderIndex(enc Encoder) int {
+	for i, e := range c.encoders {
+		if e == enc {
+			return i
+		}
 	}
+	c.encoders = append(c.encoders, enc)
+	return len(c.encoders) - 1
+}
 
-	l.errHandle(
-		l.close(),
-		os.Rename(l.op.fullPath(), l.op.rename()),
-		l.newWriterCloserFromFile(),
-	)
+// WithWriterCloser ...
+func (l *Log) WithWriterCloser(wc io.WriteCloser, needAutoRename, nopClose bool) *Log {
+	l.main.setWriter(wc, needAutoRename, nopClose)
+	return l
+}
 
+// WithFileWriter ...
+func (l *Log) WithFileWriter(root, topic, fname string) *Log {
+	l.main.setFile(root, topic, fname)
+	return l
 }
 
-func (l *Log) write(level LevelType, msg string, md ...encode.Meta) {
-	sync := l.syncBuf.write(l.recordBuf.write(level, msg, md))
-	if l.op.syncDirect || sync {
-		l.lock()
-		defer l.unlock()
-		l.sync()
-		return
+func (c *core) errHandle(errs ...error) {
+	if errHandle := c.op.errHandler; errHandle != nil {
+		for _, err := range errs {
+			if err != nil {
+				errHandle(err)
+			}
+		}
 	}
-
 }
 
-func (l *Log) makedir() error {
-	dir := l.op.dir()
-	if len(dir) == 0 {
-		return nil
+func (l *Log) write(level LevelType, msg string, md ...encode.Meta) {
+	e := entry{level: level, msg: msg}
+	if l.op.caller {
+		// skip write and the method of Log calling it.
+		e.caller = lookupCaller(callerPC(2 + l.op.callerSkip))
 	}
-	fi, err := os.Stat(dir)
-	if err == nil && fi.IsDir() {
-		return nil
+	if level >= l.op.stackLevel {
+		e.stack = l.op.stackMeta(l.op.stack())
 	}
-	return os.MkdirAll(dir, 0755)
+	l.output(e, md)
 }
 
-func (l *Log) newWriterCloserFromFile() error {
-	f, err := os.OpenFile(l.op.fullPath(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
-		return err
+// output encodes e and md once per distinct encoder and fans it out to the sinks enabled for its level.
+// An error of a sink is reported without stopping the others.
+func (l *Log) output(e entry, md []encode.Meta) {
+	if l.isClosed() {
+		return
 	}
-	l.wc = f
-	l.autoReName = false
-	l.op.cTime = time.Now().Unix()
-	if !l.op.isAutoRenameFile() {
-		l.nopClose = true
-		return nil
+	rb := getRecordBuffer()
+	if l.op.enableTimeField {
+		e.time = l.op.timeMeta(rb)
 	}
-	l.autoReName = true
-	fi, err := f.Stat()
-	if err == nil {
-		l.curFileSize = fi.Size()
-		l.op.cTime = fi.ModTime().Unix()
+	e.hooks = rb.evalHooks(l.op.hook)
+	if l.async != nil {
+		r := l.encodeAsync(rb, &e, md)
+		putRecordBuffer(rb)
+		l.async.enqueue(r, l.stop)
+		return
+	}
+	l.encodeEntry(rb, &e, md, func(i int, b []byte) {
+		for _, s := range l.sinks {
+			if s.encIdx == i && s.enabled(e.level) {
+				s.syncBuf.write(b)
+			}
+		}
+	})
+	putRecordBuffer(rb)
+	for _, s := range l.sinks {
+		if s.enabled(e.level) && (s.op.syncDirect || s.syncBuf.full()) {
+			if err := s.flush(); err != ErrClosed {
+				l.errHandle(err)
+			}
+		}
 	}
-	return nil
 }
 
-func (l *Log) close() error {
-	if l.nopClose {
-		return nil
+// encodeEntry calls emit with the record encoded in rb by each of the distinct encoders
+// of the sinks enabled for the level of e. The record is only valid until emit returns.
+// md is kept apart from e, so that the fields of the caller do not escape along with e.
+func (l *Log) encodeEntry(rb *recordBuffer, e *entry, md []encode.Meta, emit func(i int, b []byte)) {
+	for i, enc := range l.encoders {
+		for _, s := range l.sinks {
+			if s.encIdx == i && s.enabled(e.level) {
+				e.fields = l.fields[i]
+				emit(i, rb.write(l.op, enc, e, md))
+				break
+			}
+		}
 	}
-	return l.wc.Close()
 }
 
 func (l *Log) backendSync() {
+	l.wg.Add(1)
 	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.op.syncInterval)
+		defer ticker.Stop()
 		for {
-			time.Sleep(l.op.syncInterval)
-			if l.op.syncDirect {
-				continue
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+			}
+			for _, s := range l.sinks {
+				if s.op.syncDirect {
+					continue
+				}
+				if err := s.flush(); err != ErrClosed {
+					l.errHandle(err)
+				}
 			}
-			l.lock()
-			l.sync()
-			l.unlock()
 		}
 	}()
 }
 
-func (l *Log) lock() {
-	l.lo.Lock()
-}
-
-func (l *Log) unlock() {
-	l.lo.Unlock()
-}
-
 func wrapPath(paths ...string) string {
 	var b []byte
 	isFirst := true
@@ -1,7 +1,17 @@
 package simplelog
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -10,11 +20,9 @@ import (
 	"github.com/tanzy2018/simplelog/internal"
 )
 
-var once sync.Once
-
 func TestSimpleLog(t *testing.T) {
 	newLog := New()
-	defer newLog.Sync()
+	defer newLog.Close()
 	newLog.Hook(func() encode.Meta {
 		return encode.Int("socore", internal.RandInt(100))
 	})
@@ -33,49 +41,664 @@ func TestSimpleLog(t *testing.T) {
 	newLog.Info("infomsg", encode.Int("uid", 12), encode.String("detail", "xxxxinfo...."))
 	newLog.Warn("warnmsg", encode.Int("uid", 13), encode.String("detail", "xxxxwarn...."))
 	newLog.Error("errmsg", encode.Int("uid", 13), Err(errors.New("a error")), encode.String("detail", "xxxxwarn...."))
-	newLog.Panic("panicmsg", encode.Int("uid", 13), encode.String("detail", "xxxxwarn...."))
+	func() {
+		defer func() {
+			if _, ok := recover().(*PanicValue); !ok {
+				t.Error("expected Panic to panic with a *PanicValue")
+			}
+		}()
+		newLog.Panic("panicmsg", encode.Int("uid", 13), encode.String("detail", "xxxxwarn...."))
+	}()
 	// newLog.Fatal("fatalmsg", encode.Int("uid", 13), encode.String("detail", "xxxxwarn...."))
 }
 
-func BenchmarkSimpleLog(b *testing.B) {
+type testWriter struct {
+	bytes.Buffer
+}
+
+func (w *testWriter) Close() error {
+	return nil
+}
+
+func (w *testWriter) records(t *testing.T) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(w.Bytes()), []byte{'\n'}) {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWith(t *testing.T) {
+	w := &testWriter{}
+	parent := New().WithWriterCloser(w, false, true)
+	child := parent.With(encode.String("request_id", "r1"))
+	grandChild := child.With(encode.Int("user_id", 7))
+
+	grandChild.Info("grandchild", encode.Int("uid", 1))
+	child.Info("child")
+	parent.Info("parent")
+
+	records := w.records(t)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, actual %d", len(records))
+	}
+	if records[0]["request_id"] != "r1" || records[0]["user_id"] != float64(7) || records[0]["uid"] != float64(1) {
+		t.Errorf("unexpected grandchild record: %v", records[0])
+	}
+	if records[1]["request_id"] != "r1" || records[1]["user_id"] != nil {
+		t.Errorf("unexpected child record: %v", records[1])
+	}
+	if records[2]["request_id"] != nil {
+		t.Errorf("fields leaked into parent record: %v", records[2])
+	}
+}
+
+func TestNewIsolated(t *testing.T) {
+	appW, auditW := &testWriter{}, &testWriter{}
+	appLog := New(WithLevel(WARN)).WithWriterCloser(appW, false, true)
+	auditLog := New(
+		WithTimeField("ts", TimestampUnixFormat),
+		WithLevelFieldName("severity"),
+		WithMessageFieldName("event"),
+	).WithWriterCloser(auditW, false, true)
+	auditLog.Hook(func() encode.Meta {
+		return encode.String("audit", "yes")
+	})
+
+	appLog.Info("dropped")
+	appLog.Warn("app")
+	auditLog.Info("audit")
+
+	app, audit := appW.records(t), auditW.records(t)
+	if len(app) != 1 || app[0]["msg"] != "app" || app[0]["level"] != "warn" || app[0]["audit"] != nil {
+		t.Errorf("unexpected app records: %v", app)
+	}
+	if _, ok := app[0]["time"].(string); !ok {
+		t.Errorf("expected a formatted time, actual %v", app[0]["time"])
+	}
+	if len(audit) != 1 || audit[0]["event"] != "audit" || audit[0]["severity"] != "info" || audit[0]["audit"] != "yes" {
+		t.Errorf("unexpected audit records: %v", audit)
+	}
+	if _, ok := audit[0]["ts"].(float64); !ok {
+		t.Errorf("expected a unix timestamp, actual %v", audit[0]["ts"])
+	}
+
+	noTimeW := &testWriter{}
+	New(WithTimeField("", "")).WithWriterCloser(noTimeW, false, true).Info("no time")
+	if record := noTimeW.records(t)[0]; record["time"] != nil {
+		t.Errorf("expected no time field, actual %v", record)
+	}
+}
+
+// testLine returns the short file:line of its caller, the way WithCaller reports it.
+func testLine() (file string, line int) {
+	_, file, line, _ = runtime.Caller(1)
+	return filepath.Base(filepath.Dir(file)) + "/" + filepath.Base(file), line
+}
+
+type testAdapter struct {
+	l *Log
+}
+
+func (a testAdapter) Infof(format string, args ...interface{}) {
+	a.l.Info(fmt.Sprintf(format, args...))
+}
+
+func TestCaller(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithCallerFunc(true)).WithWriterCloser(w, false, true)
+	child := l.With(encode.String("request_id", "r1"))
+	adapter := testAdapter{New(WithCaller(true), WithCallerSkip(1)).WithWriterCloser(w, false, true)}
+
+	l.Info("direct")
+	file, direct := testLine()
+	child.Warn("child")
+	_, fromChild := testLine()
+	adapter.Infof("adapter %d", 1)
+	_, fromAdapter := testLine()
+	New().WithWriterCloser(w, false, true).Info("no caller")
+
+	records := w.records(t)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, actual %d", len(records))
+	}
+	for i, line := range []int{direct, fromChild, fromAdapter} {
+		if expected := file + ":" + strconv.Itoa(line-1); records[i]["caller"] != expected {
+			t.Errorf("record %d: expected caller %q, actual %v", i, expected, records[i]["caller"])
+		}
+	}
+	if records[0]["func"] != "simplelog.TestCaller" {
+		t.Errorf("unexpected func: %v", records[0]["func"])
+	}
+	if records[2]["func"] != nil || records[3]["caller"] != nil {
+		t.Errorf("unexpected caller fields: %v, %v", records[2], records[3])
+	}
+}
+
+func TestStacktrace(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithStacktraceLevel(ERROR), WithStackDepth(1)).WithWriterCloser(w, false, true)
+	l.Warn("no stack")
+	l.Error("joined")
+	New(WithStacktraceLevel(WARN), WithStackFrames(true)).WithWriterCloser(w, false, true).Warn("frames")
+	_, line := testLine()
+
+	records := w.records(t)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, actual %d", len(records))
+	}
+	if records[0]["stack"] != nil {
+		t.Errorf("unexpected stack: %v", records[0]["stack"])
+	}
+	if stack, _ := records[1]["stack"].(string); strings.Contains(stack, "->") ||
+		!strings.HasSuffix(stack, ".(github.com/tanzy2018/simplelog.TestStacktrace)") {
+		t.Errorf("expected only the frame of the test, actual %q", stack)
+	}
+	frames, _ := records[2]["stack"].([]interface{})
+	if len(frames) < 2 {
+		t.Fatalf("expected the frames of the test and testing, actual %v", records[2]["stack"])
+	}
+	if frame, _ := frames[0].(map[string]interface{}); frame["func"] != "github.com/tanzy2018/simplelog.TestStacktrace" ||
+		frame["line"] != float64(line-1) || !strings.HasSuffix(frame["file"].(string), "log_test.go") {
+		t.Errorf("unexpected first frame: %v", frames[0])
+	}
+	for _, f := range frames {
+		if fn := f.(map[string]interface{})["func"].(string); strings.HasPrefix(fn, "runtime.") {
+			t.Errorf("unexpected runtime frame: %v", f)
+		}
+	}
+}
+
+func TestPanic(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithSyncDirect(false)).WithWriterCloser(w, false, true)
+	l.Info("buffered")
+	func() {
+		defer func() {
+			p, ok := recover().(*PanicValue)
+			if !ok || p.Msg != "boom" || len(p.Fields) != 1 || string(p.Fields[0].Key()) != "uid" {
+				t.Errorf("unexpected panic value: %#v", p)
+			}
+			if records := w.records(t); len(records) != 2 || records[1]["msg"] != "boom" {
+				t.Errorf("expected the records to be flushed before panic, actual %v", records)
+			}
+		}()
+		l.Panic("boom", encode.Int("uid", 1))
+	}()
+
+	var called string
+	New(WithPanicBehavior(func(msg string, md []encode.Meta) {
+		called = msg
+	})).WithWriterCloser(w, false, true).Panic("custom")
+	New(WithPanicBehavior(NopPanicHook)).WithWriterCloser(w, false, true).Panic("nop")
+	if called != "custom" {
+		t.Errorf("expected the custom hook to be called, actual %q", called)
+	}
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithCaller(true), WithStackFrames(true)).WithWriterCloser(w, false, true)
+	var line int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer l.RecoverAndLog()
+		_, line = testLine()
+		panic(errors.New("boom"))
+	}()
+	<-done
+	func() {
+		defer l.RecoverAndLog()
+		panic("not an error")
+	}()
+
+	records := w.records(t)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, actual %d", len(records))
+	}
+	if records[0]["level"] != "error" || records[0]["panic"] != "boom" || records[1]["panic"] != "not an error" {
+		t.Errorf("unexpected records: %v", records)
+	}
+	if caller, _ := records[0]["caller"].(string); !strings.HasSuffix(caller, "log_test.go:"+strconv.Itoa(line+1)) {
+		t.Errorf("expected the caller of the panic, actual %q", caller)
+	}
+	if frames, _ := records[0]["stack"].([]interface{}); len(frames) == 0 {
+		t.Errorf("expected the stack, actual %v", records[0]["stack"])
+	}
+}
+
+func TestFatal(t *testing.T) {
+	w := &testWriter{}
+	code := 0
+	l := New(WithSyncDirect(false), WithExitCode(3), WithExitFunc(func(c int) {
+		code = c
+	})).WithWriterCloser(w, false, true)
+	var order []string
+	l.OnFatal(func() {
+		order = append(order, "first")
+		l.Info("cleanup")
+	})
+	l.With(encode.String("child", "yes")).OnFatal(func() {
+		order = append(order, "second")
+	})
+	l.Fatal("fatalmsg", encode.Int("uid", 1))
+
+	if code != 3 {
+		t.Errorf("expected exit code 3, actual %d", code)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("unexpected order of the hooks: %v", order)
+	}
+	if records := w.records(t); len(records) != 2 || records[0]["level"] != "fatal" || records[1]["msg"] != "cleanup" {
+		t.Errorf("unexpected records: %v", records)
+	}
+
+	// the hooks run in their own goroutine.
+	errs := make(chan error, 2)
+	release := make(chan struct{})
+	defer close(release)
+	l = New(WithFatalHookTimeout(time.Millisecond*10), WithExitFunc(func(c int) {
+		code = c
+	}), WithErrorHandler(func(err error) {
+		errs <- err
+	})).WithWriterCloser(w, false, true)
+	l.OnFatal(func() {
+		panic("broken hook")
+	})
+	l.OnFatal(func() {
+		<-release
+	})
+	l.Fatal("timeout")
+	if code != -1 || len(errs) != 2 {
+		t.Errorf("expected the default code and 2 errors, actual %d, %d", code, len(errs))
+	}
+}
+
+type testCloseWriter struct {
+	testWriter
+	closed int
+}
+
+func (w *testCloseWriter) Close() error {
+	w.closed++
+	return nil
+}
+
+func TestConcurrentWrite(t *testing.T) {
+	w := &testWriter{}
+	newLog := New().WithWriterCloser(w, false, true)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				newLog.Info("infomsg", encode.Int("goroutine", i), encode.Int("seq", j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := newLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// records(t) fails on a record overwritten while being written.
+	if records := w.records(t); len(records) != 8*200 {
+		t.Errorf("expected %d records, actual %d", 8*200, len(records))
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		t.Run("async="+strconv.FormatBool(async), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "simplelog")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			ops := []Option{
+				WithErrorHandler(func(err error) {
+					t.Error(err)
+				}),
+				WithSinks(NewSink(&testWriter{}, &ConsoleEncoder{}, WARN, true)),
+			}
+			if async {
+				ops = append(ops, WithAsync(64, OverflowDropOldest))
+			}
+			newLog := New(ops...).WithWriterCloser(&testWriter{}, false, true)
+			stop := make(chan struct{})
+			var changes sync.WaitGroup
+			changes.Add(1)
+			go func() {
+				defer changes.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					newLog.SetLevel(LevelType(i%4 + 1))
+					if i < 10 {
+						hook := i
+						newLog.Hook(func() encode.Meta {
+							return encode.Int("hook", hook)
+						})
+					}
+					if i%10 == 0 {
+						newLog.WithFileWriter(dir, "", "stress.log")
+						newLog.errHandle(newLog.Reopen())
+					} else {
+						newLog.WithWriterCloser(&testWriter{}, false, true)
+					}
+					newLog.errHandle(newLog.Flush())
+				}
+			}()
+			var wg sync.WaitGroup
+			for i := 0; i < 200; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					child := newLog.With(encode.Int("goroutine", i))
+					for j := 0; j < 50; j++ {
+						child.Info("infomsg", encode.Int("seq", j))
+						child.Warn("warnmsg")
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(stop)
+			changes.Wait()
+			if err := newLog.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	w := &testCloseWriter{}
+	l := New(WithSyncDirect(false)).WithWriterCloser(w, false, false)
+	child := l.With(encode.String("child", "yes"))
+	l.Info("buffered")
+	if w.Len() != 0 {
+		t.Fatalf("expected the record to be buffered, actual %q", w.String())
+	}
+	if err := l.Sync(); err != nil || w.closed != 0 {
+		t.Fatalf("expected Sync to flush without closing, actual %v, %d", err, w.closed)
+	}
+	child.Info("before close")
+	if err := l.Close(); err != nil || w.closed != 1 {
+		t.Fatalf("expected Close to close the writer once, actual %v, %d", err, w.closed)
+	}
+	child.Info("after close")
+	l.Error("after close")
+	if records := w.records(t); len(records) != 2 || records[1]["msg"] != "before close" {
+		t.Errorf("unexpected records: %v", records)
+	}
+	if err := l.Close(); err != ErrClosed {
+		t.Errorf("expected ErrClosed, actual %v", err)
+	}
+	if err := child.Flush(); err != ErrClosed {
+		t.Errorf("expected ErrClosed, actual %v", err)
+	}
+
+	nop := &testCloseWriter{}
+	if err := New().WithWriterCloser(nop, false, true).Shutdown(context.Background()); err != nil || nop.closed != 0 {
+		t.Errorf("expected the nopClose writer not to be closed, actual %v, %d", err, nop.closed)
+	}
+}
+
+func TestSetWriterAfterClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var errs []error
+	w := &testCloseWriter{}
+	l := New(WithErrorHandler(func(err error) { errs = append(errs, err) })).WithWriterCloser(w, false, false)
+	l.Close()
+
+	other := &testCloseWriter{}
+	l.WithWriterCloser(other, false, false).WithFileWriter(dir, "topic", "app.log")
+	l.Info("after close")
+	if len(errs) != 2 || errs[0] != ErrClosed || errs[1] != ErrClosed {
+		t.Errorf("expected ErrClosed twice, actual %v", errs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "topic")); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be opened, actual %v", err)
+	}
+	if w.closed != 1 || other.Len() != 0 {
+		t.Errorf("expected the writers untouched, actual %d, %q", w.closed, other.String())
+	}
+}
+
+type testBlockingWriter struct {
+	release chan struct{}
+}
+
+func (w testBlockingWriter) Write(b []byte) (int, error) {
+	<-w.release
+	return len(b), nil
+}
+
+func (w testBlockingWriter) Close() error {
+	return nil
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	w := testBlockingWriter{release: make(chan struct{})}
+	l := New(WithSyncDirect(false)).WithWriterCloser(w, false, true)
+	l.Info("blocked")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := l.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, actual %v", err)
+	}
+	close(w.release)
+}
+
+// countGoroutines counts the goroutines with fn in their stacks.
+func countGoroutines(fn string) int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	n := 0
+	for _, g := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.Contains(g, []byte(fn)) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCloseNoGoroutineLeak(t *testing.T) {
+	const fn = "simplelog.(*Log).backendSync"
+	before := countGoroutines(fn)
+	var logs []*Log
+	for i := 0; i < 10; i++ {
+		logs = append(logs, New(WithSyncInterval(time.Millisecond)).WithWriterCloser(&testWriter{}, false, true))
+	}
+	if n := countGoroutines(fn); n != before+10 {
+		t.Fatalf("expected %d goroutines, actual %d", before+10, n)
+	}
+	for _, l := range logs {
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Close waits for the goroutines to exit.
+	if n := countGoroutines(fn); n != before {
+		t.Errorf("expected %d goroutines after Close, actual %d", before, n)
+	}
+}
+
+func newBenchLog() *Log {
 	// runtime.GOMAXPROCS(1)
 	// var newLog *Log
 	newLog := New(
 		WithSyncDirect(false),
+		WithTimeField(TimeFieldName, time.StampMilli),
 		WithMaxRecordSize(1024*10),
 		WithMaxSyncSize(1024*1024),
 		WithMaxFileSize(1024*1024*1024)).
 		WithWriterCloser(Discard, false, true)
 	// WithFileWriter("testdata", "", "simplelog.txt")
-	once.Do(func() {
-		TimeFieldFormat = time.StampMilli
-		score := internal.RandInt(100)
-		newLog.Hook(func() encode.Meta {
-			return encode.Int("score", score)
-		})
+	score := internal.RandInt(100)
+	newLog.Hook(func() encode.Meta {
+		return encode.Int("score", score)
+	})
 
-		newLog.Hook(func() encode.Meta {
-			return encode.String("service", "demo")
-		})
+	newLog.Hook(func() encode.Meta {
+		return encode.String("service", "demo")
+	})
 
-		newLog.Hook(func() encode.Meta {
-			return encode.String("from", "demo-service")
-		})
+	newLog.Hook(func() encode.Meta {
+		return encode.String("from", "demo-service")
+	})
 
-		serverID := int64(internal.RandInt(1000) + 1000)
-		newLog.Hook(func() encode.Meta {
-			return encode.Int64("service-id", serverID)
-		})
+	serverID := int64(internal.RandInt(1000) + 1000)
+	newLog.Hook(func() encode.Meta {
+		return encode.Int64("service-id", serverID)
+	})
+
+	randomStr := internal.RandomString(1024)
+	newLog.Hook(func() encode.Meta {
+		return encode.String("randomstr", randomStr)
+	})
+	return newLog
+}
 
-		randomStr := internal.RandomString(1024)
-		newLog.Hook(func() encode.Meta {
-			return encode.String("randomstr", randomStr)
+func BenchmarkSimpleLog(b *testing.B) {
+	b.Run("serial", func(b *testing.B) {
+		newLog := newBenchLog()
+		defer newLog.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			newLog.Info("infomsg", encode.Int("uid", 12), encode.String("detail", "xxxxinfo...."))
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		newLog := newBenchLog()
+		defer newLog.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				newLog.Info("infomsg", encode.Int("uid", 12), encode.String("detail", "xxxxinfo...."))
+			}
 		})
 	})
-	defer newLog.Sync()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		newLog.Info("infomsg", encode.Int("uid", 12), encode.String("detail", "xxxxinfo...."))
+	// a Meta is a value holding the typed fields in place, so a log call allocates nothing.
+	b.Run("parallel-typed", func(b *testing.B) {
+		newLog := New(WithSyncDirect(false)).WithWriterCloser(Discard, false, true)
+		defer newLog.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				newLog.Info("infomsg", encode.Int("uid", 12), encode.String("detail", "xxxxinfo...."))
+			}
+		})
+	})
+}
+
+type testVerboseErr struct{}
+
+func (e testVerboseErr) Error() string {
+	return "failed"
+}
+
+func (e testVerboseErr) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprint(s, "failed\nstack")
+		return
+	}
+	fmt.Fprint(s, e.Error())
+}
+
+type testStringer func() string
+
+func (f testStringer) String() string {
+	return f()
+}
+
+func TestErrAndStringer(t *testing.T) {
+	w := &testWriter{}
+	newLog := New(WithLevel(INFO)).WithWriterCloser(w, false, true)
+	called := false
+	newLog.Debug("disabled", encode.Stringer("lazy", testStringer(func() string {
+		called = true
+		return "lazy"
+	})))
+	if called {
+		t.Errorf("Stringer should not be evaluated for a disabled level")
 	}
 
+	newLog.With(encode.NamedErr("bound", testVerboseErr{})).Error("failed", Err(testVerboseErr{}))
+	record := w.records(t)[0]
+	if record["err"] != "failed" || record["errVerbose"] != "failed\nstack" || record["boundVerbose"] != "failed\nstack" {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+func FuzzRecordIsValidJSON(f *testing.F) {
+	f.Add("msg", "key", "value")
+	f.Add("a \"quoted\" msg", "k\\ey", "line1\nline2\ttab")
+	f.Add("\x00\x1f\x7f", "\xff\xfe", "<script>&</script>")
+	f.Add("中文", "日本語", "\xe2\x80\xa8\xed\xa0\x80")
+	f.Fuzz(func(t *testing.T, msg, key, value string) {
+		for _, escapeHTML := range []bool{false, true} {
+			w := &testWriter{}
+			// a size large enough for no field to be dropped or truncated.
+			newLog := New(WithMaxRecordSize(1<<20), WithEscapeHTML(escapeHTML)).WithWriterCloser(w, false, true)
+			key := "k_" + key
+			newLog.Info(msg, encode.String(key, value), encode.Strings("strs", []string{value, key}),
+				encode.Object("obj", encode.String(key, value)), encode.Any("any", []string{value}))
+			newLog.Close()
+
+			if escapeHTML && bytes.ContainsAny(w.Bytes(), "<>&") {
+				t.Errorf("unescaped html in %q", w.Bytes())
+			}
+
+			records := w.records(t)
+			if len(records) != 1 {
+				t.Fatalf("expected 1 record, actual %d", len(records))
+			}
+			record := records[0]
+			if want := roundTrip(t, msg); record["msg"] != want {
+				t.Errorf("msg: actual %q, want %q", record["msg"], want)
+			}
+			if want := roundTrip(t, value); record[roundTrip(t, key)] != want {
+				t.Errorf("value: actual %q, want %q", record[roundTrip(t, key)], want)
+			}
+			strs, _ := record["strs"].([]interface{})
+			if len(strs) != 2 || strs[0] != roundTrip(t, value) || strs[1] != roundTrip(t, key) {
+				t.Errorf("strs: actual %q", record["strs"])
+			}
+			if obj, _ := record["obj"].(map[string]interface{}); obj[roundTrip(t, key)] != roundTrip(t, value) {
+				t.Errorf("obj: actual %q", record["obj"])
+			}
+			if arr, _ := record["any"].([]interface{}); len(arr) != 1 || arr[0] != roundTrip(t, value) {
+				t.Errorf("any: actual %q", record["any"])
+			}
+		}
+	})
+}
+
+// roundTrip returns s as encoding/json sees it after a marshal and unmarshal.
+func roundTrip(t *testing.T, s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out string
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
 }
@@ -0,0 +1,159 @@
+package simplelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/tanzy2018/simplelog/encode"
+	"github.com/tanzy2018/simplelog/internal"
+)
+
+// LogfmtEncoder ... an Encoder writing logfmt lines, e.g.
+//
+//	time="2020-08-11 10:28:18" level=info msg=profile name=Tom id=10
+//
+// Values are quoted and escaped if they contain spaces, '=', quotes or control characters.
+// Arrays and objects, such as the ones of encode.Ints and encode.Any, are flattened
+// into one pair per leaf with dotted keys in the order they were encoded:
+//
+//	ids.0=1 ids.1=2 user.name=Tom user.tags.0=admin
+//
+// and empty ones are written as key=[] or key={}.
+type LogfmtEncoder struct{}
+
+// NewLogfmtEncoder ...
+func NewLogfmtEncoder() *LogfmtEncoder {
+	return &LogfmtEncoder{}
+}
+
+// Begin ...
+func (enc *LogfmtEncoder) Begin(dst []byte) []byte {
+	return dst
+}
+
+// AppendTime ...
+func (enc *LogfmtEncoder) AppendTime(dst []byte, md encode.Meta) []byte {
+	return enc.AppendMeta(dst, md)
+}
+
+// AppendLevel ...
+func (enc *LogfmtEncoder) AppendLevel(dst []byte, key string, level LevelType) []byte {
+	dst = enc.appendKey(dst, internal.ToBytes(key))
+	return appendKeyValue(dst, internal.ToBytes(level.String()))
+}
+
+// AppendMsg ...
+func (enc *LogfmtEncoder) AppendMsg(dst []byte, key, msg string) []byte {
+	dst = enc.appendKey(dst, internal.ToBytes(key))
+	return appendKeyValue(dst, internal.ToBytes(msg))
+}
+
+// AppendMeta ...
+func (enc *LogfmtEncoder) AppendMeta(dst []byte, md encode.Meta) []byte {
+	if md.Wrap() {
+		dst = enc.appendKey(dst, md.Key())
+		return appendKeyValue(dst, md.Value())
+	}
+	value := md.Value()
+	if len(value) == 0 || (value[0] != '[' && value[0] != '{') {
+		dst = enc.appendKey(dst, md.Key())
+		return append(dst, value...)
+	}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	flattened, err := enc.appendFlattened(dst, internal.ToString(md.Key()), dec)
+	if err != nil {
+		// not a valid JSON value, keep it as a single quoted value.
+		dst = enc.appendKey(dst, md.Key())
+		return appendKeyValue(dst, value)
+	}
+	return flattened
+}
+
+// AppendEncoded ...
+func (enc *LogfmtEncoder) AppendEncoded(dst, fields []byte) []byte {
+	if len(fields) == 0 {
+		return dst
+	}
+	return append(enc.appendSpace(dst), fields...)
+}
+
+// AppendStack ...
+func (enc *LogfmtEncoder) AppendStack(dst []byte, md encode.Meta) []byte {
+	dst = enc.appendKey(dst, md.Key())
+	return appendKeyValue(dst, md.Value())
+}
+
+// End ...
+func (enc *LogfmtEncoder) End(dst []byte) []byte {
+	return append(dst, endDelimiter)
+}
+
+func (enc *LogfmtEncoder) appendFlattened(dst []byte, key string, dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return dst, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		n := 0
+		for ; dec.More(); n++ {
+			subKey := strconv.Itoa(n)
+			if v == '{' {
+				if tok, err = dec.Token(); err != nil {
+					return dst, err
+				}
+				subKey, _ = tok.(string)
+			}
+			if dst, err = enc.appendFlattened(dst, key+"."+subKey, dec); err != nil {
+				return dst, err
+			}
+		}
+		if _, err = dec.Token(); err != nil {
+			return dst, err
+		}
+		if n == 0 {
+			dst = enc.appendKey(dst, internal.ToBytes(key))
+			if v == '{' {
+				return append(dst, '{', '}'), nil
+			}
+			return append(dst, '[', ']'), nil
+		}
+		return dst, nil
+	case string:
+		dst = enc.appendKey(dst, internal.ToBytes(key))
+		return appendKeyValue(dst, internal.ToBytes(v)), nil
+	case json.Number:
+		dst = enc.appendKey(dst, internal.ToBytes(key))
+		return append(dst, v...), nil
+	case bool:
+		dst = enc.appendKey(dst, internal.ToBytes(key))
+		return strconv.AppendBool(dst, v), nil
+	default:
+		dst = enc.appendKey(dst, internal.ToBytes(key))
+		return append(dst, "null"...), nil
+	}
+}
+
+// appendKey appends key followed by '=', with the characters not allowed in a logfmt key replaced by '_'.
+func (enc *LogfmtEncoder) appendKey(dst, key []byte) []byte {
+	dst = enc.appendSpace(dst)
+	if len(key) == 0 {
+		dst = append(dst, '_')
+	}
+	for _, c := range key {
+		if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return append(dst, '=')
+}
+
+func (enc *LogfmtEncoder) appendSpace(dst []byte) []byte {
+	if len(dst) == 0 || dst[len(dst)-1] == endDelimiter {
+		return dst
+	}
+	return append(dst, ' ')
+}
@@ -3,26 +3,40 @@ package simplelog
 import (
 	"fmt"
 	"os"
-	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/tanzy2018/simplelog/internal"
+	"github.com/tanzy2018/simplelog/encode"
 )
 
-var defaultOption = _defaultOPtion()
-
 var notAutoRenameFileNames = [3]string{"/dev/stdout", "/dev/stdin", "/dev/stderr"}
 
 func _defaultOPtion() *options {
 	return &options{
-		level:          int32(DEBUG),
-		maxFileSize:    1024 * 1024 * 1024,
-		maxSyncBufSize: 1024 * 1024,
-		maxRecordSize:  1024 * 10,
-		syncDirect:     true,
-		syncInterval:   time.Second * 1,
-		hook:           new(hook),
+		level:           NewAtomicLevel(DEBUG),
+		maxFileSize:     1024 * 1024 * 1024,
+		maxSyncBufSize:  1024 * 1024,
+		maxRecordSize:   1024 * 10,
+		syncDirect:      true,
+		syncInterval:    time.Second * 1,
+		hook:            new(hook),
+		timeFieldName:   TimeFieldName,
+		timeFieldFormat: TimeFieldFormat,
+		levelFieldName:  LevelFieldName,
+		msgFieldName:    MsgFieldName,
+		stackFieldName:  StackFieldName,
+		callerFieldName: CallerFieldName,
+		funcFieldName:   FuncFieldName,
+		stackLevel:      PANIC,
+		stackDepth:      20,
+		panicHook:       DefaultPanicHook,
+		exitCode:        -1,
+		exitFunc:        os.Exit,
+		fatalTimeout:    time.Second * 5,
+		checkInterval:   time.Second,
+		droppedInterval: time.Second * 10,
+		enableTimeField: EnableTimeField,
 		errHandler: func(err error) {
 			fmt.Fprintf(os.Stderr, "log err:%v\n", err)
 		},
@@ -35,7 +49,7 @@ type ErrorHandler func(error)
 // Option ...
 type Option func(op *options)
 type options struct {
-	level          int32
+	level          *AtomicLevel
 	root           string
 	topic          string
 	fname          string
@@ -47,6 +61,61 @@ type options struct {
 	cTime          int64
 	syncInterval   time.Duration
 	hook           IHook
+	escapeHTML     bool
+	encoder        Encoder
+	floatPolicy    encode.FloatPolicy
+
+	// periodStart is the start of the period of the current file, per schedule.
+	periodStart time.Time
+	schedule    rotateSchedule
+	retention   retention
+	compress    CompressFormat
+	// rotateSeq is the last {seq} of the rotated files, 0 until scanned.
+	rotateSeq      int
+	rotateTemplate string
+	rotateLayout   string
+
+	symlink       string
+	reopenSignals []os.Signal
+	checkInterval time.Duration
+
+	enableTimeField bool
+	timeFieldName   string
+	timeFieldFormat string
+	levelFieldName  string
+	msgFieldName    string
+	stackFieldName  string
+	callerFieldName string
+	funcFieldName   string
+
+	caller     bool
+	callerSkip int
+	callerFunc bool
+
+	stackLevel  LevelType
+	stackDepth  int
+	stackFrames bool
+
+	panicHook PanicHook
+
+	exitCode     int
+	exitFunc     func(int)
+	fatalTimeout time.Duration
+
+	// sinks are the destinations of WithSinks besides the main one.
+	sinks []*Sink
+
+	// asyncSize is the capacity of the queue of WithAsync, 0 for writing in the caller.
+	asyncSize       int
+	overflow        OverflowPolicy
+	droppedInterval time.Duration
+
+	// cacheTime is set by New if the time field only changes by the second,
+	// the field being encoded once a second into timeCache.
+	cacheTime bool
+	timeCache atomic.Value
+
+	recordSizePolicy RecordSizePolicy
 }
 
 func (op *options) fullPath() string {
@@ -56,22 +125,6 @@ func (op *options) fullPath() string {
 		strings.Trim(strings.ReplaceAll(op.fname, "\\", "/"), "/"))
 }
 
-func (op *options) rename() string {
-	full := op.fullPath()
-	base := path.Base(op.fname)
-	ext := path.Ext(base)
-	subfix := genRenameSubfix(op.cTime, time.Now().Unix())
-
-	newName := make([]byte, 0, 1+len(full)+len(subfix))
-	newName = append(newName, full[:len(full)-len(base)]...)
-	newName = append(newName, base[:len(base)-len(ext)]...)
-	newName = append(newName, subfix...)
-	if len(ext) > 0 {
-		newName = append(newName, ext...)
-	}
-	return internal.ToString(newName)
-}
-
 func (op *options) dir() string {
 	return wrapPath(
 		strings.TrimRight(strings.ReplaceAll(op.root, "\\", "/"), "/"),
@@ -108,26 +161,46 @@ func WithMaxSyncSize(size int) Option {
 	}
 }
 
-// WithMaxRecordSize ...
+// WithMaxRecordSize ... the size of a record, 10KB by default, beyond which the fields
+// are handled per the RecordSizePolicy of WithRecordSizePolicy.
 func WithMaxRecordSize(size int) Option {
 	return func(op *options) {
 		op.maxRecordSize = size
 	}
 }
 
+// WithRecordSizePolicy ... what to do with the fields beyond WithMaxRecordSize,
+// RecordDropFields by default.
+func WithRecordSizePolicy(p RecordSizePolicy) Option {
+	return func(op *options) {
+		op.recordSizePolicy = p
+	}
+}
+
 // WithLevel ...
 func WithLevel(level LevelType) Option {
 	return func(op *options) {
 		if level.isValid() {
-			op.level = int32(level)
+			op.level = NewAtomicLevel(level)
 		}
 	}
 }
 
-// WithHook ...
+// WithAtomicLevel ... share al between loggers, so that changing it affects them all.
+func WithAtomicLevel(al *AtomicLevel) Option {
+	return func(op *options) {
+		if al != nil {
+			op.level = al
+		}
+	}
+}
+
+// WithHook ... replaces the hooks of the Log, nil is ignored.
 func WithHook(hook IHook) Option {
 	return func(op *options) {
-		op.hook = hook
+		if hook != nil {
+			op.hook = hook
+		}
 	}
 }
 
@@ -153,3 +226,293 @@ func WithErrorHandler(f ErrorHandler) Option {
 		op.errHandler = f
 	}
 }
+
+// WithEscapeHTML ... escape '<', '>' and '&' in msg, keys and string values of the default JSONEncoder.
+func WithEscapeHTML(escapeHTML bool) Option {
+	return func(op *options) {
+		op.escapeHTML = escapeHTML
+	}
+}
+
+// WithTimeField ... the name and the format of the time field.
+// An empty name disables the time field, an empty format keeps the current one.
+// The format is a time layout or one of TimestampUnixFormat, TimestampUnixMilliFormat,
+// TimestampUnixMicroFormat and TimestampUnixNanoFormat.
+func WithTimeField(name, format string) Option {
+	return func(op *options) {
+		op.enableTimeField = len(name) > 0
+		if len(name) > 0 {
+			op.timeFieldName = name
+		}
+		if len(format) > 0 {
+			op.timeFieldFormat = format
+		}
+	}
+}
+
+// WithLevelFieldName ...
+func WithLevelFieldName(name string) Option {
+	return func(op *options) {
+		if len(name) > 0 {
+			op.levelFieldName = name
+		}
+	}
+}
+
+// WithMessageFieldName ...
+func WithMessageFieldName(name string) Option {
+	return func(op *options) {
+		if len(name) > 0 {
+			op.msgFieldName = name
+		}
+	}
+}
+
+// WithStackFieldName ...
+func WithStackFieldName(name string) Option {
+	return func(op *options) {
+		if len(name) > 0 {
+			op.stackFieldName = name
+		}
+	}
+}
+
+// WithEncoder ... the format of the records, JSONEncoder by default.
+func WithEncoder(enc Encoder) Option {
+	return func(op *options) {
+		op.encoder = enc
+	}
+}
+
+// WithFloatPolicy ... how NaN, +Inf and -Inf are encoded, since JSON cannot represent them.
+// encode.FloatAsString by default.
+func WithFloatPolicy(p encode.FloatPolicy) Option {
+	return func(op *options) {
+		op.floatPolicy = p
+	}
+}
+
+// WithCaller ... add the file:line of the caller to every record, e.g. "caller":"pkg/handler.go:42".
+func WithCaller(caller bool) Option {
+	return func(op *options) {
+		op.caller = caller
+	}
+}
+
+// WithCallerSkip ... skip n more frames to find the caller, for the wrappers of Log.
+func WithCallerSkip(n int) Option {
+	return func(op *options) {
+		if n >= 0 {
+			op.callerSkip = n
+		}
+	}
+}
+
+// WithCallerFunc ... add the short function name of the caller too, e.g. "func":"pkg.(*Handler).ServeHTTP".
+// It implies WithCaller(true).
+func WithCallerFunc(callerFunc bool) Option {
+	return func(op *options) {
+		op.callerFunc = callerFunc
+		if callerFunc {
+			op.caller = true
+		}
+	}
+}
+
+// WithStacktraceLevel ... add the stack to the records of level and above, PANIC by default.
+// NOLEVEL disables the stack.
+func WithStacktraceLevel(level LevelType) Option {
+	return func(op *options) {
+		op.stackLevel = level
+	}
+}
+
+// WithStackDepth ... the max frames of the stack, 20 by default.
+func WithStackDepth(depth int) Option {
+	return func(op *options) {
+		if depth > 0 {
+			op.stackDepth = depth
+		}
+	}
+}
+
+// WithStackFrames ... encode the stack as an array of frames, e.g.
+// "stack":[{"func":"main.main","file":"/demo/main.go","line":11}],
+// instead of a single string joined by "->".
+func WithStackFrames(frames bool) Option {
+	return func(op *options) {
+		op.stackFrames = frames
+	}
+}
+
+// WithPanicBehavior ... what Log.Panic does after writing the record,
+// DefaultPanicHook to panic, NopPanicHook to return, or a custom one.
+func WithPanicBehavior(hook PanicHook) Option {
+	return func(op *options) {
+		if hook == nil {
+			hook = NopPanicHook
+		}
+		op.panicHook = hook
+	}
+}
+
+// WithExitCode ... the exit code of Log.Fatal, -1 by default.
+func WithExitCode(code int) Option {
+	return func(op *options) {
+		op.exitCode = code
+	}
+}
+
+// WithExitFunc ... the function Log.Fatal exits with, os.Exit by default.
+// Log.Fatal returns if f returns, which makes the fatal path testable.
+func WithExitFunc(f func(code int)) Option {
+	return func(op *options) {
+		if f != nil {
+			op.exitFunc = f
+		}
+	}
+}
+
+// WithFatalHookTimeout ... how long Log.Fatal waits for the hooks of OnFatal, 5s by default.
+func WithFatalHookTimeout(dur time.Duration) Option {
+	return func(op *options) {
+		if dur > 0 {
+			op.fatalTimeout = dur
+		}
+	}
+}
+
+// WithRotateInterval ... rotate the file every d, aligned to the local midnight if d is at most a day,
+// e.g. time.Hour rotates at every o'clock. The rotated file is named by the start of its period,
+// such as demo.2020-08-11.log. It works along with WithMaxFileSize.
+func WithRotateInterval(d time.Duration) Option {
+	return func(op *options) {
+		if d > 0 {
+			op.schedule.interval = d
+		}
+	}
+}
+
+// WithRotateAt ... rotate the file at the local clocks in HH:MM, e.g. WithRotateAt("00:00", "12:00").
+// The invalid clocks are ignored. It works along with WithRotateInterval and WithMaxFileSize.
+func WithRotateAt(clocks ...string) Option {
+	return func(op *options) {
+		op.schedule.at = sortedClocks(clocks)
+	}
+}
+
+// WithMaxBackups ... keep at most n rotated files, deleting the oldest after each rotation.
+func WithMaxBackups(n int) Option {
+	return func(op *options) {
+		if n >= 0 {
+			op.retention.maxBackups = n
+		}
+	}
+}
+
+// WithMaxAge ... delete the rotated files older than d after each rotation.
+func WithMaxAge(d time.Duration) Option {
+	return func(op *options) {
+		if d >= 0 {
+			op.retention.maxAge = d
+		}
+	}
+}
+
+// WithMaxTotalSize ... keep the total size of the rotated files within size bytes,
+// deleting the oldest after each rotation. The current file is not counted.
+func WithMaxTotalSize(size int64) Option {
+	return func(op *options) {
+		if size >= 0 {
+			op.retention.maxTotalSize = size
+		}
+	}
+}
+
+// WithCompressRotated ... compress the rotated files in the background, e.g. demo.2020-08-11.log.gz
+// with CompressGzip. The compressed files count as backups for the retention.
+func WithCompressRotated(format CompressFormat) Option {
+	return func(op *options) {
+		op.compress = format
+	}
+}
+
+// WithRotateNameTemplate ... the name of the rotated files, with the placeholders
+// {base} (demo of demo.log), {ext} (.log), {start} and {end} (the period of the file),
+// and {seq}, a sequence going on from the rotated files in the directory, e.g.
+// "{base}-{seq}{ext}" for demo-0001.log, demo-0002.log and so on.
+// It is DefaultRotateNameTemplate, or DefaultPeriodNameTemplate along with WithRotateInterval or WithRotateAt.
+func WithRotateNameTemplate(tpl string) Option {
+	return func(op *options) {
+		op.rotateTemplate = tpl
+	}
+}
+
+// WithRotateTimeLayout ... the numeric layout of {start} and {end} of WithRotateNameTemplate,
+// DefaultRotateTimeLayout by default, or the coarsest one telling the periods of
+// WithRotateInterval and WithRotateAt apart, such as 2006-01-02 for a daily rotation.
+func WithRotateTimeLayout(layout string) Option {
+	return func(op *options) {
+		op.rotateLayout = layout
+	}
+}
+
+// WithCurrentSymlink ... keep a symlink named name, in the directory of the file of WithFileWriter,
+// pointing to the file, e.g. demo.current.log. It is refreshed whenever the file is opened.
+func WithCurrentSymlink(name string) Option {
+	return func(op *options) {
+		op.symlink = name
+	}
+}
+
+// WithReopenOnSignal ... Log.Reopen on sigs, SIGHUP if none, until Log.Close.
+func WithReopenOnSignal(sigs ...os.Signal) Option {
+	return func(op *options) {
+		if len(sigs) == 0 {
+			sigs = defaultReopenSignals
+		}
+		op.reopenSignals = sigs
+	}
+}
+
+// WithFileCheckInterval ... how often to check if the file of WithFileWriter was deleted or moved
+// underneath, reopening it if so, 1s by default. It is checked on writing only, 0 disables it.
+func WithFileCheckInterval(d time.Duration) Option {
+	return func(op *options) {
+		if d >= 0 {
+			op.checkInterval = d
+		}
+	}
+}
+
+// WithSinks ... write the records to sinks as well, each one filtered by its own level
+// after the level of the Log. The records are encoded once per distinct Encoder, told apart by ==.
+func WithSinks(sinks ...*Sink) Option {
+	return func(op *options) {
+		op.sinks = append(op.sinks, sinks...)
+	}
+}
+
+// WithAsync ... hand the records over to a queue of capacity, drained by a writer goroutine,
+// so that the callers do not wait for the writers. The records are encoded by the caller,
+// and policy decides what to do when the queue is full, see OverflowPolicy.
+// Flush, Panic, Fatal and Close wait for the records queued before them.
+func WithAsync(capacity int, policy OverflowPolicy) Option {
+	return func(op *options) {
+		if capacity > 0 {
+			op.asyncSize = capacity
+			op.overflow = policy
+		}
+	}
+}
+
+// WithDroppedInterval ... how often to log a summary of the records dropped by WithAsync,
+// and once more on Close, 10s by default, 0 disables it. The summary is logged at WARN with msg "dropped"
+// and the count since the last one under "dropped", bypassing the queue.
+func WithDroppedInterval(d time.Duration) Option {
+	return func(op *options) {
+		if d >= 0 {
+			op.droppedInterval = d
+		}
+	}
+}
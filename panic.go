@@ -0,0 +1,57 @@
+package simplelog
+
+import (
+	"github.com/tanzy2018/simplelog/encode"
+)
+
+// PanicValue ... the value Log.Panic panics with by DefaultPanicHook.
+type PanicValue struct {
+	Msg    string
+	Fields []encode.Meta
+}
+
+// Error ...
+func (p *PanicValue) Error() string {
+	return p.Msg
+}
+
+// PanicHook ... called by Log.Panic once the record is flushed, see WithPanicBehavior.
+type PanicHook func(msg string, md []encode.Meta)
+
+// DefaultPanicHook ... panics with a *PanicValue.
+func DefaultPanicHook(msg string, md []encode.Meta) {
+	panic(&PanicValue{Msg: msg, Fields: md})
+}
+
+// NopPanicHook ... returns normally, so the code after Log.Panic keeps running.
+func NopPanicHook(msg string, md []encode.Meta) {}
+
+// RecoverAndLog ... recovers a panic and writes it at ERROR with the stack of the panic,
+// it must be deferred directly, e.g.
+//
+//	go func() {
+//		defer newLog.RecoverAndLog()
+//		...
+//	}()
+//
+// The panic is not propagated, even if ERROR is disabled by the level.
+func (l *Log) RecoverAndLog() {
+	r := recover()
+	if r == nil || l.op.level.Level() > ERROR {
+		return
+	}
+	// the frames of the runtime and RecoverAndLog are dropped,
+	// so the stack starts from where the panic happened.
+	frames := l.op.stack()
+	e := entry{level: ERROR, msg: "recovered from panic", stack: l.op.stackMeta(frames)}
+	if l.op.caller && len(frames) > 0 {
+		e.caller = newCallerFrame(&frames[0])
+	}
+	var md encode.Meta
+	if err, ok := r.(error); ok {
+		md = encode.NamedErr("panic", err)
+	} else {
+		md = encode.Any("panic", r)
+	}
+	l.output(e, []encode.Meta{md})
+}
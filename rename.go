@@ -0,0 +1,151 @@
+package simplelog
+
+import (
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRotateNameTemplate ... the name of the files rotated by size,
+	// e.g. demo.20200811T101500_20200811T121500.log.
+	DefaultRotateNameTemplate = "{base}.{start}_{end}{ext}"
+	// DefaultPeriodNameTemplate ... the name of the files rotated by WithRotateInterval
+	// or WithRotateAt, e.g. demo.2020-08-11.log.
+	DefaultPeriodNameTemplate = "{base}.{start}{ext}"
+	// DefaultRotateTimeLayout ... the layout of {start} and {end}, safe in file names.
+	DefaultRotateTimeLayout = "20060102T150405"
+)
+
+// nameTemplate ... the template of WithRotateNameTemplate, or the default one.
+func (op *options) nameTemplate() string {
+	switch {
+	case len(op.rotateTemplate) > 0:
+		return op.rotateTemplate
+	case op.schedule.enabled():
+		return DefaultPeriodNameTemplate
+	default:
+		return DefaultRotateNameTemplate
+	}
+}
+
+// nameLayout ... the layout of WithRotateTimeLayout, or the coarsest one telling the periods apart.
+func (op *options) nameLayout() string {
+	switch {
+	case len(op.rotateLayout) > 0:
+		return op.rotateLayout
+	case op.schedule.enabled():
+		return op.schedule.layout()
+	default:
+		return DefaultRotateTimeLayout
+	}
+}
+
+// rename returns the name to rotate the current file to. A name taken already,
+// compressed or not, is told apart by .1, .2 and so on before {ext}.
+func (op *options) rename() string {
+	tpl, layout := op.nameTemplate(), op.nameLayout()
+	start, end := time.Unix(op.cTime, 0), time.Now()
+	if op.schedule.enabled() {
+		start = op.periodStart
+	}
+	seq := 0
+	if strings.Contains(tpl, "{seq}") {
+		if op.rotateSeq == 0 {
+			op.rotateSeq = op.lastSeq()
+		}
+		op.rotateSeq++
+		seq = op.rotateSeq
+	}
+	name := op.renderName(tpl, layout, start, end, seq, "")
+	for n := 1; fileExists(name) || fileExists(name+op.compress.ext()); n++ {
+		name = op.renderName(tpl, layout, start, end, seq, "."+strconv.Itoa(n))
+	}
+	return name
+}
+
+func (op *options) renderName(tpl, layout string, start, end time.Time, seq int, dup string) string {
+	full := op.fullPath()
+	base := path.Base(full)
+	ext := extOf(base)
+	seqStr := strconv.Itoa(seq)
+	// padded, so that the names sort by seq.
+	if len(seqStr) < 4 {
+		seqStr = strings.Repeat("0", 4-len(seqStr)) + seqStr
+	}
+	name := strings.NewReplacer(
+		"{base}", base[:len(base)-len(ext)],
+		"{start}", start.Format(layout),
+		"{end}", end.Format(layout),
+		"{seq}", seqStr,
+		"{ext}", dup+ext,
+	).Replace(tpl)
+	if !strings.Contains(tpl, "{ext}") {
+		name += dup
+	}
+	return full[:len(full)-len(base)] + name
+}
+
+// backupPattern matches the names of the rotated files per the template, compressed or not.
+// The first {seq}, if any, is the first submatch.
+func (op *options) backupPattern() *regexp.Regexp {
+	tpl := op.nameTemplate()
+	base := path.Base(op.fullPath())
+	ext := extOf(base)
+	timePattern := layoutPattern(op.nameLayout())
+	pattern := strings.Replace(regexp.QuoteMeta(tpl), `\{seq\}`, `(\d+)`, 1)
+	pattern = strings.NewReplacer(
+		`\{base\}`, regexp.QuoteMeta(base[:len(base)-len(ext)]),
+		`\{start\}`, timePattern,
+		`\{end\}`, timePattern,
+		`\{seq\}`, `\d+`,
+		`\{ext\}`, `(?:\.\d+)?`+regexp.QuoteMeta(ext),
+	).Replace(pattern)
+	if !strings.Contains(tpl, "{ext}") {
+		pattern += `(?:\.\d+)?`
+	}
+	return regexp.MustCompile("^" + pattern + `(?:\.gz)?$`)
+}
+
+// layoutPattern matches the times formatted by layout, the runs of digits being of any length.
+func layoutPattern(layout string) string {
+	sample := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(layout)
+	var b strings.Builder
+	for i := 0; i < len(sample); i++ {
+		if c := sample[i]; c < '0' || c > '9' {
+			b.WriteString(regexp.QuoteMeta(sample[i : i+1]))
+			continue
+		}
+		b.WriteString(`\d+`)
+		for i+1 < len(sample) && sample[i+1] >= '0' && sample[i+1] <= '9' {
+			i++
+		}
+	}
+	return b.String()
+}
+
+// lastSeq returns the largest {seq} of the rotated files in the directory, 0 if none.
+func (op *options) lastSeq() int {
+	dir := op.dir()
+	if len(dir) == 0 {
+		dir = "."
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	pattern, last := op.backupPattern(), 0
+	for _, fi := range fis {
+		m := pattern.FindStringSubmatch(fi.Name())
+		if len(m) < 2 {
+			continue
+		}
+		if seq, err := strconv.Atoi(m[1]); err == nil && seq > last {
+			last = seq
+		}
+	}
+	return last
+}
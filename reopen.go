@@ -0,0 +1,85 @@
+package simplelog
+
+import (
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+)
+
+// Reopen ... closes and reopens the files of WithFileWriter and the sinks, so that
+// the external rotation such as logrotate with create works. The other writers are left as they are.
+func (l *Log) Reopen() error {
+	var err error
+	for _, s := range l.sinks {
+		if serr := s.reopen(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// backendReopen reopens the file on the signals of WithReopenOnSignal.
+func (l *Log) backendReopen() {
+	if len(l.op.reopenSignals) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, l.op.reopenSignals...)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ch:
+				if err := l.Reopen(); err != ErrClosed {
+					l.errHandle(err)
+				}
+			}
+		}
+	}()
+}
+
+// orReopenFile reopens the file if it was deleted or moved underneath, checking once
+// per the interval of WithFileCheckInterval. The size is refreshed as well,
+// since the file may have been truncated, e.g. by logrotate with copytruncate.
+func (s *Sink) orReopenFile() {
+	if s.file == nil || s.op.checkInterval <= 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(s.lastCheck) < s.op.checkInterval {
+		return
+	}
+	s.lastCheck = now
+	fi, err := os.Stat(s.op.fullPath())
+	cur, cerr := s.file.Stat()
+	if err == nil && cerr == nil && os.SameFile(fi, cur) {
+		s.curFileSize = cur.Size()
+		return
+	}
+	s.errHandle(s.close(), s.makedir(), s.newWriterCloserFromFile())
+}
+
+// updateSymlink points the symlink of WithCurrentSymlink to the current file,
+// replacing it atomically.
+func (s *Sink) updateSymlink() error {
+	if len(s.op.symlink) == 0 {
+		return nil
+	}
+	full := s.op.fullPath()
+	link := path.Join(path.Dir(full), s.op.symlink)
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(path.Base(full), tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, link)
+}
+
+// defaultReopenSignals ... the signals of WithReopenOnSignal without any.
+var defaultReopenSignals = []os.Signal{syscall.SIGHUP}
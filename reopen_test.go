@@ -0,0 +1,130 @@
+package simplelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCurrentSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := New(WithCurrentSymlink("demo.current.log"), WithMaxFileSize(150)).WithFileWriter(dir, "", "demo.log")
+	defer l.Close()
+	link := filepath.Join(dir, "demo.current.log")
+	if target, err := os.Readlink(link); err != nil || target != "demo.log" {
+		t.Fatalf("expected the symlink to demo.log, actual %q, %v", target, err)
+	}
+	l.Info("rotated " + strings.Repeat("x", 100))
+	l.Info("current")
+	if content := readFile(t, link); !strings.Contains(content, "current") || strings.Contains(content, "rotated") {
+		t.Errorf("expected the symlink to the current file, actual %q", content)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+
+	l := New(WithFileCheckInterval(0)).WithFileWriter(dir, "", "demo.log")
+	defer l.Close()
+	l.Info("before")
+	// logrotate with create.
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("moved")
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("after")
+	if content := readFile(t, name+".1"); !strings.Contains(content, "before") || !strings.Contains(content, "moved") {
+		t.Errorf("unexpected moved file: %q", content)
+	}
+	if content := readFile(t, name); !strings.Contains(content, "after") || strings.Contains(content, "moved") {
+		t.Errorf("unexpected reopened file: %q", content)
+	}
+	if err := New().Reopen(); err != nil {
+		t.Errorf("expected Reopen to do nothing for stdout, actual %v", err)
+	}
+}
+
+func TestReopenDeletedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+
+	l := New(WithFileCheckInterval(time.Nanosecond)).WithFileWriter(dir, "", "demo.log")
+	defer l.Close()
+	l.Info("before")
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("after")
+	if content := readFile(t, name); !strings.Contains(content, "after") {
+		t.Errorf("expected the file to be recreated, actual %q", content)
+	}
+
+	// truncated underneath, e.g. by copytruncate.
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("truncated")
+	l.main.lock()
+	size := l.main.curFileSize
+	l.main.unlock()
+	if fi, err := os.Stat(name); err != nil || fi.Size() != size {
+		t.Errorf("expected the size to be refreshed to %v, actual %d", fi.Size(), size)
+	}
+}
+
+func TestReopenOnSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+
+	l := New(WithReopenOnSignal(), WithFileCheckInterval(0)).WithFileWriter(dir, "", "demo.log")
+	defer l.Close()
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("signals not supported: %v", err)
+	}
+	for i := 0; i < 100 && !fileExists(name); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if !fileExists(name) {
+		t.Error("expected the file to be reopened on SIGHUP")
+	}
+}
@@ -0,0 +1,83 @@
+package simplelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// retention ... how many rotated files to keep, set by WithMaxBackups, WithMaxAge and WithMaxTotalSize.
+type retention struct {
+	maxBackups   int
+	maxAge       time.Duration
+	maxTotalSize int64
+}
+
+func (r retention) enabled() bool {
+	return r.maxBackups > 0 || r.maxAge > 0 || r.maxTotalSize > 0
+}
+
+// afterRotate compresses the rotated file, if any, and then deletes the rotated files
+// beyond the retention in the background. Close waits for it.
+func (s *Sink) afterRotate(rotated string) {
+	compress, r := s.op.compress, s.op.retention
+	if compress == CompressNone {
+		rotated = ""
+	}
+	if len(rotated) == 0 && !r.enabled() {
+		return
+	}
+	dir, pattern := s.op.dir(), s.op.backupPattern()
+	if len(dir) == 0 {
+		dir = "."
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.cleanLo.Lock()
+		defer s.cleanLo.Unlock()
+		if len(rotated) > 0 {
+			s.errHandle(compressFile(rotated, compress))
+		}
+		if r.enabled() {
+			s.errHandle(removeBackups(dir, pattern, r, time.Now())...)
+		}
+	}()
+}
+
+// removeBackups removes the files in dir matching pattern, from the oldest,
+// until the rest are within r.
+func removeBackups(dir string, pattern *regexp.Regexp, r retention, now time.Time) []error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return []error{err}
+	}
+	backups := fis[:0]
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && pattern.MatchString(fi.Name()) {
+			backups = append(backups, fi)
+		}
+	}
+	// the newest first.
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].ModTime().After(backups[j].ModTime())
+	})
+	var (
+		errs  []error
+		total int64
+	)
+	for i, fi := range backups {
+		total += fi.Size()
+		if (r.maxBackups > 0 && i >= r.maxBackups) ||
+			(r.maxAge > 0 && now.Sub(fi.ModTime()) > r.maxAge) ||
+			(r.maxTotalSize > 0 && total > r.maxTotalSize) {
+			if err := os.Remove(path.Join(dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,231 @@
+package simplelog
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// rotateSchedule ... the wall-clock boundaries to rotate the file at,
+// set by WithRotateInterval and WithRotateAt.
+type rotateSchedule struct {
+	// interval is aligned to the local midnight if it is at most a day.
+	interval time.Duration
+	// at are the minutes of the day, sorted.
+	at []int
+}
+
+func (s *rotateSchedule) enabled() bool {
+	return s.interval > 0 || len(s.at) > 0
+}
+
+// prev returns the last boundary not after t.
+func (s *rotateSchedule) prev(t time.Time) time.Time {
+	var p time.Time
+	if s.interval > 0 {
+		p = s.prevInterval(t)
+	}
+	if len(s.at) > 0 {
+		if pa := s.prevAt(t); pa.After(p) {
+			p = pa
+		}
+	}
+	return p
+}
+
+// next returns the first boundary after t.
+func (s *rotateSchedule) next(t time.Time) time.Time {
+	var n time.Time
+	if s.interval > 0 {
+		n = s.nextInterval(t)
+	}
+	if len(s.at) > 0 {
+		if na := s.nextAt(t); n.IsZero() || na.Before(n) {
+			n = na
+		}
+	}
+	return n
+}
+
+func (s *rotateSchedule) prevInterval(t time.Time) time.Time {
+	if s.interval > 24*time.Hour {
+		return t.Truncate(s.interval)
+	}
+	midnight := dayAt(t, 0, 0)
+	return midnight.Add(t.Sub(midnight) / s.interval * s.interval)
+}
+
+func (s *rotateSchedule) nextInterval(t time.Time) time.Time {
+	if s.interval > 24*time.Hour {
+		return t.Truncate(s.interval).Add(s.interval)
+	}
+	// an interval not dividing the day restarts at the next midnight.
+	n, nextMidnight := s.prevInterval(t).Add(s.interval), dayAt(t, 1, 0)
+	if n.After(nextMidnight) {
+		return nextMidnight
+	}
+	return n
+}
+
+func (s *rotateSchedule) prevAt(t time.Time) time.Time {
+	for day := 0; ; day-- {
+		for i := len(s.at) - 1; i >= 0; i-- {
+			if p := dayAt(t, day, s.at[i]); !p.After(t) {
+				return p
+			}
+		}
+	}
+}
+
+func (s *rotateSchedule) nextAt(t time.Time) time.Time {
+	for day := 0; ; day++ {
+		for _, minute := range s.at {
+			if n := dayAt(t, day, minute); n.After(t) {
+				return n
+			}
+		}
+	}
+}
+
+// layout ... the coarsest time layout telling the periods apart, e.g. 2006-01-02 for a daily rotation.
+func (s *rotateSchedule) layout() string {
+	unit := 24 * time.Hour
+	if s.interval > 0 {
+		unit = gcdDuration(unit, s.interval)
+	}
+	for _, minute := range s.at {
+		unit = gcdDuration(unit, time.Duration(minute)*time.Minute)
+	}
+	switch {
+	case unit%(24*time.Hour) == 0:
+		return "2006-01-02"
+	case unit%time.Hour == 0:
+		return "2006-01-02-15"
+	case unit%time.Minute == 0:
+		return "2006-01-02-1504"
+	default:
+		return "2006-01-02-150405"
+	}
+}
+
+// dayAt returns the minute of the day days after the day of t, in the location of t.
+func dayAt(t time.Time, days, minute int) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+days, minute/60, minute%60, 0, 0, t.Location())
+}
+
+func gcdDuration(a, b time.Duration) time.Duration {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// parseClock parses HH:MM into the minute of the day.
+func parseClock(clock string) (int, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+func extOf(full string) string {
+	for i := len(full) - 1; i >= 0 && full[i] != '/'; i-- {
+		if full[i] == '.' {
+			return full[i:]
+		}
+	}
+	return ""
+}
+
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+func (s *Sink) rotate() {
+	rotated := s.op.rename()
+	err := os.Rename(s.op.fullPath(), rotated)
+	s.errHandle(
+		s.close(),
+		err,
+		s.newWriterCloserFromFile(),
+	)
+	if err != nil {
+		rotated = ""
+	}
+	s.afterRotate(rotated)
+}
+
+// backendRotate rotates the file at the boundaries of the schedule, even with no records.
+func (s *Sink) backendRotate() {
+	if !s.op.schedule.enabled() {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.lock()
+			next := s.op.schedule.next(s.op.periodStart)
+			s.unlock()
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-s.rotateReset:
+				// the file has changed, e.g. by WithFileWriter, and so may have next.
+				timer.Stop()
+				continue
+			case <-timer.C:
+			}
+			s.lock()
+			if !s.isClosed() {
+				s.rotateByTime(time.Now())
+			}
+			s.unlock()
+		}
+	}()
+}
+
+// resetRotate makes the rotate goroutine recompute the next boundary from the period of the file.
+func (s *Sink) resetRotate() {
+	select {
+	case s.rotateReset <- struct{}{}:
+	default:
+	}
+}
+
+// rotateStale rotates at once a file of a past period, e.g. not rotated since the last run of the program.
+func (s *Sink) rotateStale() {
+	if s.op.schedule.enabled() {
+		s.rotateByTime(time.Now())
+	}
+}
+
+func (s *Sink) rotateByTime(now time.Time) {
+	// the file may have changed while waiting.
+	if now.Before(s.op.schedule.next(s.op.periodStart)) {
+		return
+	}
+	s.errHandle(s.sync())
+	if s.autoReName && s.curFileSize > 0 {
+		s.rotate()
+		return
+	}
+	s.op.periodStart = s.op.schedule.prev(now)
+}
+
+// sortedClocks parses the clocks of WithRotateAt, dropping the invalid ones.
+func sortedClocks(clocks []string) []int {
+	at := make([]int, 0, len(clocks))
+	for _, clock := range clocks {
+		if minute, ok := parseClock(clock); ok {
+			at = append(at, minute)
+		}
+	}
+	sort.Ints(at)
+	return at
+}
@@ -0,0 +1,278 @@
+package simplelog
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanzy2018/simplelog/encode"
+)
+
+func TestRotateSchedule(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 8, day, hour, minute, 0, 0, loc)
+	}
+	testData := []struct {
+		name       string
+		schedule   rotateSchedule
+		now        time.Time
+		prev, next time.Time
+		layout     string
+	}{
+		{"daily", rotateSchedule{interval: 24 * time.Hour}, at(11, 13, 5), at(11, 0, 0), at(12, 0, 0), "2006-01-02"},
+		{"hourly", rotateSchedule{interval: time.Hour}, at(11, 13, 5), at(11, 13, 0), at(11, 14, 0), "2006-01-02-15"},
+		{"on the boundary", rotateSchedule{interval: time.Hour}, at(11, 13, 0), at(11, 13, 0), at(11, 14, 0), "2006-01-02-15"},
+		{"not dividing the day", rotateSchedule{interval: 7 * time.Hour}, at(11, 22, 0), at(11, 21, 0), at(12, 0, 0), "2006-01-02-15"},
+		{"at", rotateSchedule{at: sortedClocks([]string{"12:00", "00:00", "bad"})}, at(11, 13, 5), at(11, 12, 0), at(12, 0, 0), "2006-01-02-15"},
+		{"at before the first", rotateSchedule{at: sortedClocks([]string{"09:30"})}, at(11, 8, 0), at(10, 9, 30), at(11, 9, 30), "2006-01-02-1504"},
+		{"interval and at", rotateSchedule{interval: 6 * time.Hour, at: sortedClocks([]string{"09:30"})}, at(11, 10, 0), at(11, 9, 30), at(11, 12, 0), "2006-01-02-1504"},
+	}
+	for _, td := range testData {
+		if prev := td.schedule.prev(td.now); !prev.Equal(td.prev) {
+			t.Errorf("%s: expected prev %v, actual %v", td.name, td.prev, prev)
+		}
+		if next := td.schedule.next(td.now); !next.Equal(td.next) {
+			t.Errorf("%s: expected next %v, actual %v", td.name, td.next, next)
+		}
+		if layout := td.schedule.layout(); layout != td.layout {
+			t.Errorf("%s: expected layout %q, actual %q", td.name, td.layout, layout)
+		}
+	}
+}
+
+func TestRotateByTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := New(WithRotateInterval(24*time.Hour), WithMaxFileSize(1024)).WithFileWriter(dir, "data", "demo.log")
+	defer l.Close()
+	l.Info("day one")
+	l.main.lock()
+	start := l.op.periodStart
+	day := start.Format("2006-01-02")
+	// not yet the end of the period.
+	l.main.rotateByTime(start.Add(time.Hour))
+	l.main.unlock()
+	if _, err := os.Stat(filepath.Join(dir, "data", "demo."+day+".log")); err == nil {
+		t.Fatal("rotated before the end of the period")
+	}
+
+	// a rotation by size in the same period.
+	l.Info(string(make([]byte, 1024)))
+	l.Info("day one again")
+	l.main.lock()
+	l.main.rotateByTime(start.Add(24 * time.Hour))
+	l.main.unlock()
+	for _, name := range []string{"demo." + day + ".log", "demo." + day + ".1.log", "demo.log"} {
+		if _, err := os.Stat(filepath.Join(dir, "data", name)); err != nil {
+			t.Errorf("expected %s: %v", name, err)
+		}
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "data", "demo."+day+".1.log")); len(b) == 0 {
+		t.Error("expected the records of the rest of the period")
+	}
+}
+
+func TestRotateStaleFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+	if err := ioutil.WriteFile(name, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if err := os.Chtimes(name, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rotate goroutine has started on the period of stdout before WithFileWriter.
+	l := New(WithRotateInterval(24*time.Hour)).WithFileWriter(dir, "", "demo.log")
+	defer l.Close()
+	rotated := filepath.Join(dir, "demo."+yesterday.Format("2006-01-02")+".log")
+	if !fileExists(rotated) {
+		t.Errorf("expected the file of yesterday to be rotated to %s", rotated)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	// the backups of 1 to 5 days ago, 100 bytes each, and files not to touch.
+	for i := 1; i <= 5; i++ {
+		mtime := now.AddDate(0, 0, -i)
+		stamp := mtime.Format(DefaultRotateTimeLayout)
+		name := filepath.Join(dir, "demo."+stamp+"_"+stamp+".log")
+		if err := ioutil.WriteFile(name, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := now.AddDate(0, 0, -30)
+	for _, name := range []string{"other.20200811T101500_20200811T101500.log", "demo.log.bak", "demo.access.log"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups := func() []string {
+		names, _ := filepath.Glob(filepath.Join(dir, "demo.*_*.log"))
+		return names
+	}
+
+	testData := []struct {
+		name     string
+		option   Option
+		expected int
+	}{
+		// the new backup of today is counted as well.
+		{"max age", WithMaxAge(4*24*time.Hour - time.Minute), 4},
+		// the 2 backups of today are about 60 bytes each.
+		{"max total size", WithMaxTotalSize(350), 4},
+		{"max backups", WithMaxBackups(2), 2},
+	}
+	for _, td := range testData {
+		l := New(td.option, WithMaxFileSize(10)).WithFileWriter(dir, "", "demo.log")
+		l.Info("rotate")
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if names := backups(); len(names) != td.expected {
+			t.Errorf("%s: expected %d backups, actual %v", td.name, td.expected, names)
+		}
+	}
+	for _, name := range []string{"other.20200811T101500_20200811T101500.log", "demo.log.bak", "demo.access.log"} {
+		if !fileExists(filepath.Join(dir, name)) {
+			t.Errorf("unexpected removal of %s", name)
+		}
+	}
+}
+
+func TestCompressRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := New(WithRotateInterval(24*time.Hour), WithCompressRotated(CompressGzip), WithMaxBackups(2)).
+		WithFileWriter(dir, "", "demo.log")
+	l.main.lock()
+	day := l.op.periodStart.Format("2006-01-02")
+	l.main.unlock()
+	// rotated in the same period, so the names taken by the compressed files are skipped.
+	for i := 0; i < 3; i++ {
+		l.Info("compressed", encode.Int("i", i))
+		l.main.lock()
+		l.main.rotateByTime(l.op.periodStart.Add(24 * time.Hour))
+		l.main.unlock()
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "demo.*.*"))
+	if len(names) != 2 {
+		t.Fatalf("expected 2 backups, actual %v", names)
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".log.gz") {
+			t.Errorf("expected a compressed backup, actual %s", name)
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, "demo."+day+".2.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil || !strings.Contains(string(b), `"i":2`) {
+		t.Errorf("unexpected content %q: %v", b, err)
+	}
+}
+
+func TestRotateNameTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the sequence goes on from the files of a previous run.
+	if err := ioutil.WriteFile(filepath.Join(dir, "demo-0007.log.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := New(WithRotateNameTemplate("{base}-{seq}{ext}"), WithMaxFileSize(10), WithMaxBackups(2)).
+		WithFileWriter(dir, "", "demo.log")
+	for i := 0; i < 3; i++ {
+		l.Info("rotate")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{"demo-0007.log.gz": false, "demo-0008.log": false, "demo-0009.log": true, "demo-0010.log": true} {
+		if fileExists(filepath.Join(dir, name)) != expected {
+			t.Errorf("expected %s to exist: %v", name, expected)
+		}
+	}
+
+	l = New(WithMaxFileSize(10)).WithFileWriter(dir, "", "default.log")
+	l.Info("rotate")
+	l.Close()
+	names, _ := filepath.Glob(filepath.Join(dir, "default.*.log"))
+	if len(names) != 1 || !regexp.MustCompile(`^default\.\d{8}T\d{6}_\d{8}T\d{6}\.log$`).MatchString(filepath.Base(names[0])) {
+		t.Errorf("unexpected default names: %v", names)
+	}
+}
+
+func TestBackupPattern(t *testing.T) {
+	testData := []struct {
+		tpl, layout string
+		match       []string
+		notMatch    []string
+	}{
+		{"", "", []string{"demo.20200811T101500_20200811T121500.log", "demo.20200811T101500_20200811T121500.1.log.gz"},
+			[]string{"demo.log", "demo.access.log", "demo.20200811T101500_20200811T121500.log.bak"}},
+		{"{base}-{seq}{ext}", "", []string{"demo-0001.log", "demo-12345.log.gz"}, []string{"demo-x.log", "demo-0001.txt"}},
+		{"{base}_{start}", "2006-01-02", []string{"demo_2020-08-11", "demo_2020-08-11.1"}, []string{"demo_2020-08-11.log"}},
+	}
+	for _, td := range testData {
+		op := _defaultOPtion()
+		op.updateFileOption("", "", "demo.log")
+		op.rotateTemplate, op.rotateLayout = td.tpl, td.layout
+		pattern := op.backupPattern()
+		for _, name := range td.match {
+			if !pattern.MatchString(name) {
+				t.Errorf("%q: expected %s to match %s", td.tpl, name, pattern)
+			}
+		}
+		for _, name := range td.notMatch {
+			if pattern.MatchString(name) {
+				t.Errorf("%q: expected %s not to match %s", td.tpl, name, pattern)
+			}
+		}
+	}
+}
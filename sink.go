@@ -0,0 +1,259 @@
+package simplelog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink ... a destination of the records, with its own writer, encoder, min level,
+// buffer and rotation. Besides the writer of WithWriterCloser or WithFileWriter,
+// a Log writes to the sinks of WithSinks, e.g.
+//
+//	simplelog.New(simplelog.WithSinks(
+//		simplelog.NewSink(os.Stderr, simplelog.NewConsoleEncoder(os.Stderr), simplelog.WARN, true),
+//		simplelog.NewFileSink(".", "data", "errors.log", nil, simplelog.ERROR, simplelog.WithMaxBackups(7)),
+//	)).WithFileWriter(".", "data", "demo.log")
+//
+// A Sink belongs to a single Log.
+type Sink struct {
+	// core is the core of the Log the sink belongs to.
+	*core
+	// op holds the file, rotation and buffering options of the sink,
+	// the options of the Log for the writer of the Log itself.
+	op    *options
+	level LevelType
+	enc   Encoder
+	// encIdx is the index of enc in the distinct encoders of the core.
+	encIdx int
+
+	lo          sync.Mutex
+	wc          io.WriteCloser
+	curFileSize int64
+	autoReName  bool
+	nopClose    bool
+	syncBuf     *syncBuffer
+	// file is the file opened by the sink, nil for the other writers.
+	file *os.File
+	// lastCheck is the last time of checking file by orReopenFile.
+	lastCheck time.Time
+	// cleanLo serializes the cleanups of the rotated files.
+	cleanLo sync.Mutex
+	// rotateReset wakes the rotate goroutine up to recompute the next boundary,
+	// the period of the file having changed.
+	rotateReset chan struct{}
+}
+
+// NewSink ... a sink writing the records of level and above to w, encoded by enc,
+// or by the Encoder of the Log if enc is nil. w is not closed if nopClose.
+func NewSink(w io.WriteCloser, enc Encoder, level LevelType, nopClose bool) *Sink {
+	return &Sink{
+		op:       _defaultOPtion(),
+		level:    level,
+		enc:      enc,
+		wc:       w,
+		nopClose: nopClose,
+	}
+}
+
+// NewFileSink ... a sink writing the records of level and above to the file root/topic/fname,
+// encoded by enc, or by the Encoder of the Log if enc is nil.
+// ops configure the rotation and the buffering of the sink, such as WithMaxFileSize,
+// WithRotateInterval, WithMaxBackups, WithCompressRotated and WithSyncDirect, the others are ignored.
+func NewFileSink(root, topic, fname string, enc Encoder, level LevelType, ops ...Option) *Sink {
+	s := NewSink(nil, enc, level, false)
+	for _, f := range ops {
+		f(s.op)
+	}
+	s.op.updateFileOption(root, topic, fname)
+	return s
+}
+
+var errSinkAttached = errors.New("simplelog: the sink belongs to another Log")
+
+// attach makes s a sink of the Log of c, opening its file if any.
+func (s *Sink) attach(c *core) error {
+	if s.core != nil {
+		return errSinkAttached
+	}
+	s.core = c
+	if s.enc == nil {
+		s.enc = c.op.encoder
+	}
+	s.encIdx = c.encoderIndex(s.enc)
+	s.syncBuf = newSyncBuffers(s.op.maxSyncBufSize)
+	s.rotateReset = make(chan struct{}, 1)
+	if len(s.op.fname) == 0 {
+		return nil
+	}
+	if err := s.makedir(); err != nil {
+		return err
+	}
+	if err := s.newWriterCloserFromFile(); err != nil {
+		return err
+	}
+	s.rotateStale()
+	return nil
+}
+
+func (s *Sink) enabled(level LevelType) bool {
+	return level >= s.level
+}
+
+// flush writes the buffered records unless the Log is closed.
+func (s *Sink) flush() error {
+	s.lock()
+	defer s.unlock()
+	if s.isClosed() {
+		return ErrClosed
+	}
+	return s.sync()
+}
+
+// shutdown flushes the buffered records and closes the writer, the Log being closed.
+func (s *Sink) shutdown() error {
+	s.lock()
+	defer s.unlock()
+	err := s.sync()
+	if cerr := s.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// setWriter replaces the writer, flushing and closing the previous one, unless the Log is closed.
+func (s *Sink) setWriter(wc io.WriteCloser, needAutoRename, nopClose bool) {
+	s.lock()
+	defer s.unlock()
+	if s.isClosed() {
+		s.errHandle(ErrClosed)
+		return
+	}
+	s.errHandle(s.sync(), s.close())
+	s.wc = wc
+	s.file = nil
+	s.autoReName = needAutoRename
+	s.nopClose = nopClose
+}
+
+// setFile replaces the writer with the file root/topic/fname, flushing and closing the previous one,
+// unless the Log is closed.
+func (s *Sink) setFile(root, topic, fname string) {
+	s.lock()
+	defer s.unlock()
+	if s.isClosed() {
+		s.errHandle(ErrClosed)
+		return
+	}
+	s.errHandle(s.sync(), s.close())
+	s.op.updateFileOption(root, topic, fname)
+	s.errHandle(s.makedir())
+	if err := s.newWriterCloserFromFile(); err != nil {
+		s.errHandle(err)
+		return
+	}
+	s.rotateStale()
+}
+
+// reopen closes and reopens the file of the sink, if any.
+func (s *Sink) reopen() error {
+	s.lock()
+	defer s.unlock()
+	if s.isClosed() {
+		return ErrClosed
+	}
+	if s.file == nil {
+		return nil
+	}
+	err := s.sync()
+	for _, e := range []error{s.close(), s.makedir(), s.newWriterCloserFromFile()} {
+		if err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *Sink) sync() error {
+	b := s.syncBuf.flushAsBytes()
+	if len(b) == 0 || s.wc == nil {
+		return nil
+	}
+	s.orReopenFile()
+	s.curFileSize += int64(len(b))
+	_, err := s.wc.Write(b)
+	s.orChangeFileWriter()
+	return err
+}
+
+func (s *Sink) orChangeFileWriter() {
+	if !s.autoReName {
+		return
+	}
+	if s.curFileSize < s.op.maxFileSize {
+		return
+	}
+
+	s.rotate()
+
+}
+
+func (s *Sink) makedir() error {
+	dir := s.op.dir()
+	if len(dir) == 0 {
+		return nil
+	}
+	fi, err := os.Stat(dir)
+	if err == nil && fi.IsDir() {
+		return nil
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+func (s *Sink) newWriterCloserFromFile() error {
+	f, err := os.OpenFile(s.op.fullPath(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer s.resetRotate()
+	s.wc = f
+	s.file = nil
+	s.nopClose = false
+	s.autoReName = false
+	s.op.cTime = time.Now().Unix()
+	s.op.periodStart = s.op.schedule.prev(time.Now())
+	if !s.op.isAutoRenameFile() {
+		s.nopClose = true
+		return nil
+	}
+	s.file = f
+	s.lastCheck = time.Now()
+	s.autoReName = true
+	s.errHandle(s.updateSymlink())
+	fi, err := f.Stat()
+	if err == nil {
+		s.curFileSize = fi.Size()
+		s.op.cTime = fi.ModTime().Unix()
+		if s.curFileSize > 0 {
+			s.op.periodStart = s.op.schedule.prev(fi.ModTime())
+		}
+	}
+	return nil
+}
+
+func (s *Sink) close() error {
+	if s.nopClose || s.wc == nil {
+		return nil
+	}
+	return s.wc.Close()
+}
+
+func (s *Sink) lock() {
+	s.lo.Lock()
+}
+
+func (s *Sink) unlock() {
+	s.lo.Unlock()
+}
@@ -0,0 +1,98 @@
+package simplelog
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tanzy2018/simplelog/encode"
+)
+
+type testCountEncoder struct {
+	JSONEncoder
+	msgs int
+}
+
+func (enc *testCountEncoder) AppendMsg(dst []byte, key, msg string) []byte {
+	enc.msgs++
+	return enc.JSONEncoder.AppendMsg(dst, key, msg)
+}
+
+type testFailWriter struct{}
+
+func (testFailWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func (testFailWriter) Close() error {
+	return nil
+}
+
+func TestSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	all, warn, shared := &testWriter{}, &testWriter{}, &testWriter{}
+	enc := &testCountEncoder{}
+	var errs []error
+	l := New(
+		WithEncoder(enc),
+		WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+		WithSinks(
+			NewSink(testFailWriter{}, nil, DEBUG, true),
+			NewSink(warn, &ConsoleEncoder{}, WARN, true),
+			NewSink(shared, enc, INFO, true),
+			NewFileSink(dir, "", "errors.log", nil, ERROR),
+		),
+	).WithWriterCloser(all, false, true)
+	reqLog := l.With(encode.String("request_id", "r1"))
+
+	reqLog.Debug("debugmsg")
+	reqLog.Warn("warnmsg")
+	reqLog.Error("errmsg")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if records := all.records(t); len(records) != 3 || records[0]["request_id"] != "r1" {
+		t.Errorf("unexpected records of the main writer: %v", records)
+	}
+	if records := shared.records(t); len(records) != 2 || records[0]["msg"] != "warnmsg" {
+		t.Errorf("unexpected records of the sink at INFO: %v", records)
+	}
+	lines := strings.Split(strings.TrimSpace(warn.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "WARN") || !strings.Contains(lines[1], "request_id=r1") {
+		t.Errorf("unexpected console records: %q", warn.String())
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "errors.log"))
+	if err != nil || strings.Count(string(b), "\n") != 1 || !strings.Contains(string(b), `"msg":"errmsg"`) {
+		t.Errorf("unexpected errors.log: %q, %v", b, err)
+	}
+	// encoded once for the main writer, the failing sink and the sink sharing the encoder.
+	if enc.msgs != 3 {
+		t.Errorf("expected 3 encodings, actual %d", enc.msgs)
+	}
+	if len(errs) != 3 || errs[0].Error() != "disk full" {
+		t.Errorf("expected the errors of the failing sink, actual %v", errs)
+	}
+}
+
+func TestSinkOfAnotherLog(t *testing.T) {
+	var errs []error
+	s := NewSink(&testWriter{}, nil, DEBUG, true)
+	New(WithSinks(s)).Close()
+	New(WithSinks(s), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})).Close()
+	if len(errs) != 1 || errs[0] != errSinkAttached {
+		t.Errorf("expected errSinkAttached, actual %v", errs)
+	}
+}
@@ -0,0 +1,201 @@
+package simplelog
+
+import (
+	"strconv"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/tanzy2018/simplelog/encode"
+	"github.com/tanzy2018/simplelog/internal"
+)
+
+// RecordSizePolicy ... what to do with the fields of a record beyond WithMaxRecordSize.
+// It applies to the hooks, the custom meta and the stack, in this order.
+// Whatever the policy, a msg too large for the record is truncated as by RecordTruncate,
+// the time, level, caller and the fields bound by With being always kept.
+type RecordSizePolicy int
+
+const (
+	// RecordDropFields ... the default, drops the fields not fitting and lists their keys
+	// in the array TruncatedFieldsKey, which is kept even beyond the size.
+	RecordDropFields RecordSizePolicy = iota
+	// RecordTruncate ... truncates the value of the field not fitting into a string
+	// ending with "…(truncated N bytes)", N being the size cut from the value.
+	RecordTruncate
+	// RecordSplit ... continues the fields not fitting in the next records, which repeat
+	// the time, level, msg, caller and the fields bound by With, all the records sharing
+	// RecordIDKey. A field too large for a record alone is truncated as by RecordTruncate.
+	RecordSplit
+)
+
+const (
+	// TruncatedFieldsKey ... the key of the fields dropped by RecordDropFields.
+	TruncatedFieldsKey = "_truncated_fields"
+	// RecordIDKey ... the key of the id shared by the records split by RecordSplit.
+	RecordIDKey = "record_id"
+)
+
+// recordReserve ... the room kept below maxRecordSize for the end of the record
+// and the fields of the policies.
+const recordReserve = 64
+
+// recordIDPrefix and recordSeq make the ids of the split records unique across processes.
+var (
+	recordIDPrefix = internal.RandomString(8)
+	recordSeq      uint64
+)
+
+func newRecordID() string {
+	return recordIDPrefix + "-" + strconv.FormatUint(atomic.AddUint64(&recordSeq, 1), 10)
+}
+
+// recordWriter appends the fields of a record, applying the RecordSizePolicy.
+type recordWriter struct {
+	op  *options
+	enc Encoder
+	// e is a copy, so that the entry of the caller does not escape along with buf.
+	e   entry
+	buf []byte
+	// start is the start of the record at hand, after the records split before it,
+	// and head the end of its time, level, msg, caller and fields bound by With.
+	start, head int
+	dropped     []string
+	recordID    string
+}
+
+func (rw *recordWriter) limit() int {
+	return rw.op.maxRecordSize - recordReserve
+}
+
+func (rw *recordWriter) fits() bool {
+	return len(rw.buf)-rw.start <= rw.limit()
+}
+
+// begin starts a record, with the record id if it continues a split one,
+// truncating msg if the record would not fit otherwise.
+func (rw *recordWriter) begin() {
+	rw.start = len(rw.buf)
+	msg := internal.ToBytes(rw.e.msg)
+	cut := len(msg)
+	rw.buf = rw.appendHead(rw.buf[:rw.start], rw.e.msg)
+	for over := len(rw.buf) - rw.start - rw.limit(); over > 0 && cut > 0; over = len(rw.buf) - rw.start - rw.limit() {
+		// the size of the encoded msg is only known once encoded, mind the escaping.
+		cut = truncateAt(msg, cut-over)
+		rw.buf = rw.appendHead(rw.buf[:rw.start], internal.ToString(appendTruncated(nil, msg, cut)))
+	}
+	rw.head = len(rw.buf)
+}
+
+func (rw *recordWriter) appendHead(buf []byte, msg string) []byte {
+	op, enc, e := rw.op, rw.enc, &rw.e
+	buf = enc.Begin(buf)
+	if !e.time.IsZero() {
+		buf = enc.AppendTime(buf, e.time)
+	}
+	buf = enc.AppendLevel(buf, op.levelFieldName, e.level)
+	buf = enc.AppendMsg(buf, op.msgFieldName, msg)
+	if e.caller != nil {
+		buf = enc.AppendMeta(buf, encode.String(op.callerFieldName, e.caller.caller))
+		if op.callerFunc {
+			buf = enc.AppendMeta(buf, encode.String(op.funcFieldName, e.caller.function))
+		}
+	}
+	buf = enc.AppendEncoded(buf, e.fields)
+	if len(rw.recordID) > 0 {
+		buf = enc.AppendMeta(buf, encode.String(RecordIDKey, rw.recordID))
+	}
+	return buf
+}
+
+// end finishes the record, listing the dropped fields if any.
+func (rw *recordWriter) end() {
+	if len(rw.dropped) > 0 {
+		rw.buf = rw.enc.AppendMeta(rw.buf, encode.Strings(TruncatedFieldsKey, rw.dropped))
+	}
+	rw.buf = rw.enc.End(rw.buf)
+}
+
+// add appends md, expanding the Metas of a group such as encode.NamedErr
+// and encoding the NaN and infinite floats per the float policy.
+func (rw *recordWriter) add(md encode.Meta) {
+	md = encode.ApplyFloatPolicy(md, rw.op.floatPolicy)
+	if g := md.Metas(); g != nil {
+		for _, msg := range g {
+			rw.add(msg)
+		}
+		return
+	}
+	rw.append(md, rw.enc.AppendMeta)
+}
+
+func (rw *recordWriter) addStack(md encode.Meta) {
+	rw.append(md, rw.enc.AppendStack)
+}
+
+func (rw *recordWriter) append(md encode.Meta, appendMeta func([]byte, encode.Meta) []byte) {
+	// encode first and roll back, so that the value is only computed once if it fits.
+	n := len(rw.buf)
+	if rw.buf = appendMeta(rw.buf, md); rw.fits() {
+		return
+	}
+	rw.buf = rw.buf[:n]
+	switch rw.op.recordSizePolicy {
+	case RecordDropFields:
+		rw.dropped = append(rw.dropped, string(md.Key()))
+		return
+	case RecordSplit:
+		if n > rw.head {
+			if len(rw.recordID) == 0 {
+				rw.recordID = newRecordID()
+				rw.buf = rw.enc.AppendMeta(rw.buf, encode.String(RecordIDKey, rw.recordID))
+			}
+			rw.end()
+			rw.begin()
+			n = len(rw.buf)
+			if rw.buf = appendMeta(rw.buf, md); rw.fits() {
+				return
+			}
+			rw.buf = rw.buf[:n]
+		}
+	}
+	rw.buf = appendMeta(rw.buf, rw.truncate(md, appendMeta))
+}
+
+// truncate returns md as a string cut short enough to fit in the record, if possible.
+func (rw *recordWriter) truncate(md encode.Meta, appendMeta func([]byte, encode.Meta) []byte) encode.Meta {
+	value := md.Value()
+	cut := len(value)
+	for {
+		// the size of the encoded value is only known once encoded, mind the escaping.
+		truncated := truncatedMeta(md.Key(), value, cut)
+		over := len(appendMeta(rw.buf, truncated)) - rw.start - rw.limit()
+		if over <= 0 || cut == 0 {
+			return truncated
+		}
+		cut = truncateAt(value, cut-over)
+	}
+}
+
+// truncateAt returns cut moved back to the start of a rune of value, 0 if negative.
+func truncateAt(value []byte, cut int) int {
+	if cut <= 0 {
+		return 0
+	}
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return cut
+}
+
+// appendTruncated appends value cut at cut, ending with the marker of the size cut.
+func appendTruncated(dst, value []byte, cut int) []byte {
+	dst = append(dst, value[:cut]...)
+	dst = append(dst, "…(truncated "...)
+	dst = strconv.AppendInt(dst, int64(len(value)-cut), 10)
+	return append(dst, " bytes)"...)
+}
+
+func truncatedMeta(key, value []byte, cut int) encode.Meta {
+	b := appendTruncated(make([]byte, 0, cut+32), value, cut)
+	return encode.String(string(key), internal.ToString(b))
+}
@@ -0,0 +1,110 @@
+package simplelog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tanzy2018/simplelog/encode"
+)
+
+func TestRecordDropFields(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithMaxRecordSize(300), WithStacktraceLevel(ERROR)).WithWriterCloser(w, false, true)
+	defer l.Close()
+	l.Hook(func() encode.Meta {
+		return encode.String("hook", strings.Repeat("h", 300))
+	})
+	l.Error("errmsg", encode.Int("a", 1), encode.String("big", strings.Repeat("b", 300)), encode.Int("c", 3))
+	record := w.records(t)[0]
+	if record["a"] != float64(1) || record["c"] != float64(3) || record["big"] != nil || record["hook"] != nil {
+		t.Errorf("unexpected record: %v", record)
+	}
+	dropped, _ := record[TruncatedFieldsKey].([]interface{})
+	if len(dropped) < 2 || dropped[0] != "hook" || dropped[1] != "big" {
+		t.Errorf("expected the dropped keys, actual %v", record[TruncatedFieldsKey])
+	}
+}
+
+func TestRecordTruncate(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithMaxRecordSize(300), WithRecordSizePolicy(RecordTruncate)).WithWriterCloser(w, false, true)
+	defer l.Close()
+	l.Info("infomsg", encode.Int("a", 1), encode.String("big", strings.Repeat("ü", 300)))
+	if size := len(strings.TrimSpace(w.String())); size > 300 {
+		t.Errorf("expected a record within 300 bytes, actual %d", size)
+	}
+	record := w.records(t)[0]
+	big, _ := record["big"].(string)
+	i := strings.Index(big, "…(truncated ")
+	if record["a"] != float64(1) || i < 0 {
+		t.Fatalf("unexpected record: %v", record)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(big[i+len("…(truncated "):], " bytes)"))
+	if err != nil || i+n != len(strings.Repeat("ü", 300)) {
+		t.Errorf("expected the size cut, actual %q", big[i:])
+	}
+}
+
+func TestRecordSplit(t *testing.T) {
+	w := &testWriter{}
+	l := New(WithMaxRecordSize(300), WithRecordSizePolicy(RecordSplit)).WithWriterCloser(w, false, true)
+	defer l.Close()
+	var md []encode.Meta
+	for i := 0; i < 6; i++ {
+		md = append(md, encode.String("f"+strconv.Itoa(i), strings.Repeat("x", 80)))
+	}
+	l.With(encode.String("request_id", "r1")).Info("infomsg", md...)
+	l.Info("next")
+
+	records := w.records(t)
+	if len(records) < 3 {
+		t.Fatalf("expected the record split, actual %v", records)
+	}
+	split, id := 0, records[0][RecordIDKey]
+	for _, record := range records {
+		if record["msg"] == "next" {
+			if record[RecordIDKey] != nil {
+				t.Errorf("unexpected record id: %v", record)
+			}
+			continue
+		}
+		if record[RecordIDKey] != id || record["request_id"] != "r1" {
+			t.Errorf("unexpected record: %v", record)
+		}
+		for i := 0; i < 6; i++ {
+			if record["f"+strconv.Itoa(i)] != nil {
+				split++
+			}
+		}
+	}
+	if id == nil || split != 6 {
+		t.Errorf("expected 6 fields sharing a record id, actual %d, %v", split, id)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+		if len(line) > 300 {
+			t.Errorf("expected records within 300 bytes, actual %d", len(line))
+		}
+	}
+}
+
+func TestRecordTruncateMsg(t *testing.T) {
+	msg := strings.Repeat("m", 5000)
+	for _, p := range []RecordSizePolicy{RecordDropFields, RecordTruncate, RecordSplit} {
+		w := &testWriter{}
+		l := New(WithMaxRecordSize(300), WithRecordSizePolicy(p), WithCaller(true)).WithWriterCloser(w, false, true)
+		l.Info(msg, encode.Int("a", 1))
+		l.Close()
+		for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+			if len(line) > 300 {
+				t.Errorf("%d: expected records within 300 bytes, actual %d", p, len(line))
+			}
+		}
+		record := w.records(t)[0]
+		got, _ := record["msg"].(string)
+		i := strings.Index(got, "…(truncated ")
+		if i < 0 || got[i:] != "…(truncated "+strconv.Itoa(len(msg)-i)+" bytes)" {
+			t.Errorf("%d: unexpected msg %q", p, got)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package simplelog
 
 import (
-	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/tanzy2018/simplelog/encode"
@@ -19,17 +21,18 @@ const (
 
 const (
 	// TimestampUnixFormat ...
-	TimestampUnixFormat = "unix"
+	TimestampUnixFormat = encode.UnixLayout
 	// TimestampUnixMilliFormat ...
-	TimestampUnixMilliFormat = "unixmilli"
+	TimestampUnixMilliFormat = encode.UnixMilliLayout
 	// TimestampUnixMicroFormat ...
-	TimestampUnixMicroFormat = "unixmicro"
+	TimestampUnixMicroFormat = encode.UnixMicroLayout
 	// TimestampUnixNanoFormat ...
-	TimestampUnixNanoFormat = "unixnano"
-	// .createTime_lastmodifiedTime_randomeStr
-	renameFormat = ".%v_%v_%s"
+	TimestampUnixNanoFormat = encode.UnixNanoLayout
 )
 
+// The defaults of the field names and the time format, copied by each New.
+// Changing them does not affect the Log already created, use the options
+// such as WithTimeField to configure a single Log.
 var (
 	// EnableTimeField ...
 	EnableTimeField = true
@@ -43,60 +46,84 @@ var (
 	MsgFieldName = "msg"
 	// StackFieldName ...
 	StackFieldName = "stack"
-	// ErrFieldName ...
+	// CallerFieldName ...
+	CallerFieldName = "caller"
+	// FuncFieldName ... the key of the function name of WithCallerFunc.
+	FuncFieldName = "func"
+	// ErrFieldName ... the key of Err.
 	ErrFieldName = "err"
 )
 
-// Err ...
+// Err ... err under ErrFieldName, see encode.NamedErr to choose the key.
 func Err(err error) encode.Meta {
-	if err == nil {
-		return encode.EmptyStrMeta(ErrFieldName)
-	}
-	return encode.String(ErrFieldName, err.Error())
+	return encode.NamedErr(ErrFieldName, err)
 }
 
-func timeMeta() encode.Meta {
-	if TimeFieldFormat == TimestampUnixFormat {
-		return encode.Int64(TimeFieldName, time.Now().Unix())
-	}
+// timeCache ... the time field of a second, reused within the second.
+type timeCache struct {
+	sec int64
+	md  encode.Meta
+}
 
-	if TimeFieldFormat == TimestampUnixMilliFormat {
-		return encode.Int64(TimeFieldName, time.Now().UnixNano()/1000000)
+// timeMeta ... the time field, formatted into rb unless cached, rb being in use until it is encoded.
+func (op *options) timeMeta(rb *recordBuffer) encode.Meta {
+	now := time.Now()
+	if !op.cacheTime {
+		return rb.formatTime(op.timeFieldName, now, op.timeFieldFormat)
 	}
-
-	if TimeFieldFormat == TimestampUnixMicroFormat {
-		return encode.Int64(TimeFieldName, time.Now().UnixNano()/1000)
+	sec := now.Unix()
+	if c, _ := op.timeCache.Load().(*timeCache); c != nil && c.sec == sec {
+		return c.md
 	}
+	md := encode.TimeLayout(op.timeFieldName, now, op.timeFieldFormat)
+	op.timeCache.Store(&timeCache{sec: sec, md: md})
+	return md
+}
 
-	if TimeFieldFormat == TimestampUnixNanoFormat {
-		return encode.Int64(TimeFieldName, time.Now().UnixNano())
+// isSecondLayout reports whether the time formatted with layout only changes by the second,
+// i.e. it has no fractional seconds, which is the case of the default TimeFieldFormat.
+func isSecondLayout(layout string) bool {
+	switch layout {
+	case encode.UnixLayout:
+		return true
+	case encode.UnixMilliLayout, encode.UnixMicroLayout, encode.UnixNanoLayout:
+		return false
 	}
-
-	return encode.String(TimeFieldName, internal.TimeFormat(TimeFieldFormat))
+	for _, frac := range []string{".0", ".9", ",0", ",9"} {
+		if strings.Contains(layout, frac) {
+			return false
+		}
+	}
+	return true
 }
 
-func levelMeta(level LevelType) encode.Meta {
-	return encode.String(LevelFieldName, level.String())
-}
+// pkgPath ... the frames of simplelog itself are dropped from the stack.
+var pkgPath = reflect.TypeOf(Log{}).PkgPath()
 
-func msgMeta(msg string) encode.Meta {
-	return encode.String(MsgFieldName, msg)
+// stack ... the frames of the stack, without those of the runtime and simplelog.
+func (op *options) stack() []runtime.Frame {
+	return internal.Frames(0, op.stackDepth, isInternalFrame)
 }
 
-func stackMeta() encode.Meta {
-	return encode.String(StackFieldName, internal.CallStack(6))
+func (op *options) stackMeta(frames []runtime.Frame) encode.Meta {
+	if !op.stackFrames {
+		return encode.String(op.stackFieldName, internal.CallStack(frames))
+	}
+	md := make([]encode.Meta, len(frames))
+	for i, f := range frames {
+		md[i] = encode.Object("",
+			encode.String("func", f.Function),
+			encode.String("file", f.File),
+			encode.Int("line", f.Line),
+		)
+	}
+	return encode.Array(op.stackFieldName, md...)
 }
 
-func genRenameSubfix(csec, msec int64) string {
-
-	var v0, v1 interface{}
-	t0, t1 := time.Unix(csec, 0), time.Unix(msec, 0)
-	switch TimeFieldFormat {
-	case TimestampUnixFormat, TimestampUnixMilliFormat, TimestampUnixMicroFormat, TimestampUnixNanoFormat:
-		v0, v1 = t0.Unix(), t1.Unix()
-	default:
-		v0, v1 = t0.Format(TimeFieldFormat), t1.Format(TimeFieldFormat)
-
+// isInternalFrame reports the frames of the runtime and of simplelog, except its tests.
+func isInternalFrame(f *runtime.Frame) bool {
+	if strings.HasPrefix(f.Function, "runtime.") {
+		return true
 	}
-	return fmt.Sprintf(renameFormat, v0, v1, internal.RandomHex(4))
+	return strings.HasPrefix(f.Function, pkgPath+".") && !strings.HasSuffix(f.File, "_test.go")
 }